@@ -0,0 +1,162 @@
+package graph
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/gorilla/mux"
+	"io"
+	"kontrakt-server/graph/auth"
+	"kontrakt-server/prisma/db"
+	"kontrakt-server/storage"
+	"kontrakt-server/utils"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	attachmentURLDuration       = 15 * time.Minute
+	attachmentDownloadDuration  = time.Minute
+	attachmentStorageKeyEntropy = 16
+)
+
+// Worksheets are handed in as photos or scans
+var allowedAttachmentTypes = map[string]bool{
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"application/pdf": true,
+}
+
+// sniffAttachment checks the size of an upload and detects its type from its content rather than trusting the client.
+// The returned reader yields the whole file again.
+func sniffAttachment(file graphql.Upload, maxSize int64) (string, io.Reader, error) {
+	if file.Size > maxSize {
+		return "", nil, attachmentTooLarge(maxSize)
+	}
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file.File, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return "", nil, err
+	}
+	head = head[:n]
+	contentType, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	if !allowedAttachmentTypes[contentType] {
+		return "", nil, fmt.Errorf("files of type %s are not allowed", contentType)
+	}
+	// Do not rely on the announced size when storing the file
+	content := io.LimitReader(io.MultiReader(bytes.NewReader(head), file.File), maxSize+1)
+	return contentType, content, nil
+}
+
+func attachmentTooLarge(maxSize int64) error {
+	return fmt.Errorf("a file cannot be larger than %.1f MB", float64(maxSize)/(1<<20))
+}
+
+// storeAttachment saves an upload and records it for a student skill
+func (r *Resolver) storeAttachment(ctx context.Context, studentUsername string, skillID int, file graphql.Upload) (*db.AttachmentModel, error) {
+	contentType, content, err := sniffAttachment(file, r.MaxAttachmentSize)
+	if err != nil {
+		return nil, err
+	}
+	key, err := utils.RandomToken(attachmentStorageKeyEntropy)
+	if err != nil {
+		return nil, err
+	}
+	counter := &countingReader{reader: content}
+	if err := r.Storage.Save(ctx, key, counter); err != nil {
+		return nil, err
+	}
+	if counter.count > r.MaxAttachmentSize {
+		r.Storage.Delete(ctx, key)
+		return nil, attachmentTooLarge(r.MaxAttachmentSize)
+	}
+	attachment, err := r.Prisma.Attachment.CreateOne(
+		db.Attachment.Skill.Link(db.Skill.ID.Equals(skillID)),
+		db.Attachment.Student.Link(db.Student.OwnerID.Equals(studentUsername)),
+		db.Attachment.Uploader.Link(db.User.Username.Equals(auth.ForContext(ctx).Username)),
+		db.Attachment.Filename.Set(file.Filename),
+		db.Attachment.ContentType.Set(contentType),
+		db.Attachment.Size.Set(int(counter.count)),
+		db.Attachment.StorageKey.Set(key),
+	).Exec(ctx)
+	if err != nil {
+		// Do not keep files nobody can reach
+		r.Storage.Delete(ctx, key)
+		return nil, err
+	}
+	return attachment, nil
+}
+
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+	c.count += int64(n)
+	return n, err
+}
+
+func attachmentDisposition(filename string) string {
+	return mime.FormatMediaType("inline", map[string]string{"filename": filename})
+}
+
+func attachmentPath(id int) string {
+	return "/attachments/" + strconv.Itoa(id)
+}
+
+// AttachmentHandler serves attachments to whoever holds a valid signed link.
+// Files kept in a bucket are downloaded from it, as Lambda responses cannot be larger than a few megabytes.
+func (r *Resolver) AttachmentHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		id, err := strconv.Atoi(mux.Vars(req)["id"])
+		if err != nil {
+			http.NotFound(w, req)
+			return
+		}
+		if err := utils.VerifySignedURL(attachmentPath(id), req.URL.Query()); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		attachment, err := r.Prisma.Attachment.FindUnique(db.Attachment.ID.Equals(id)).Exec(req.Context())
+		if errors.Is(err, db.ErrNotFound) {
+			http.NotFound(w, req)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if presigner, ok := r.Storage.(storage.Presigner); ok {
+			link, err := presigner.PresignGet(attachment.StorageKey, attachment.ContentType, attachmentDisposition(attachment.Filename), attachmentDownloadDuration)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			http.Redirect(w, req, link, http.StatusSeeOther)
+			return
+		}
+		content, err := r.Storage.Open(req.Context(), attachment.StorageKey)
+		if errors.Is(err, storage.ErrNotFound) {
+			http.NotFound(w, req)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer content.Close()
+		w.Header().Set("Content-Type", attachment.ContentType)
+		w.Header().Set("Content-Length", strconv.Itoa(attachment.Size))
+		w.Header().Set("Content-Disposition", attachmentDisposition(attachment.Filename))
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		io.Copy(w, content)
+	})
+}
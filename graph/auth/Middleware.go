@@ -2,14 +2,16 @@ package auth
 
 import (
 	"context"
-	"github.com/dgrijalva/jwt-go"
+	"errors"
 	"kontrakt-server/prisma/db"
 	"kontrakt-server/utils"
 	"net/http"
 	"strings"
+	"time"
 )
 
 var userCtxKey = &contextKey{"user"}
+var sessionCtxKey = &contextKey{"session"}
 
 type contextKey struct {
 	name string
@@ -18,6 +20,7 @@ type contextKey struct {
 func Middleware(prisma *db.PrismaClient) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r = r.WithContext(context.WithValue(r.Context(), ipCtxKey, clientIP(r)))
 			tokenString := r.Header.Get("Authorization")
 
 			// Allow unauthenticated users in
@@ -26,27 +29,14 @@ func Middleware(prisma *db.PrismaClient) func(next http.Handler) http.Handler {
 				return
 			}
 
-			tokenString = strings.Replace(tokenString, "Bearer ", "", 1)
-			claims, err := utils.VerifyToken(tokenString)
+			// An expired or revoked token is ignored rather than rejected, so clients still sending it can log in
+			// or refresh their session. Protected fields are refused by the directives.
+			ctx, err := Authenticate(r.Context(), prisma, tokenString)
 			if err != nil {
-				http.Error(w, "Error verifying JWT token: "+err.Error(), http.StatusUnauthorized)
-				return
-			}
-
-			username, ok := claims.(jwt.MapClaims)["username"].(string)
-			if !ok {
-				http.Error(w, "Invalid user", http.StatusForbidden)
-				return
-			}
-			user, err := prisma.User.FindUnique(db.User.Username.Equals(username)).Exec(r.Context())
-			if err != nil {
-				http.Error(w, "Invalid user", http.StatusForbidden)
+				next.ServeHTTP(w, r)
 				return
 			}
 
-			//// put it in context
-			ctx := context.WithValue(r.Context(), userCtxKey, user)
-
 			// and call the next with our new context
 			r = r.WithContext(ctx)
 			next.ServeHTTP(w, r)
@@ -54,7 +44,43 @@ func Middleware(prisma *db.PrismaClient) func(next http.Handler) http.Handler {
 	}
 }
 
+// Authenticate returns a context holding the user and the session of an access token.
+// It is used by the HTTP middleware and by websocket connections which send the token once connected.
+func Authenticate(ctx context.Context, prisma *db.PrismaClient, tokenString string) (context.Context, error) {
+	tokenString = strings.Replace(tokenString, "Bearer ", "", 1)
+	claims, err := utils.VerifyToken(tokenString, utils.AccessTokenType)
+	if err != nil {
+		return nil, errors.New("Error verifying JWT token: " + err.Error())
+	}
+
+	// Make sure the session has not been revoked since the token was issued
+	session, err := prisma.Session.FindUnique(db.Session.ID.Equals(claims.SessionID)).Exec(ctx)
+	if err != nil || !IsSessionActive(session) || session.OwnerID != claims.Username {
+		return nil, errors.New("Session expired")
+	}
+
+	user, err := prisma.User.FindUnique(db.User.Username.Equals(claims.Username)).Exec(ctx)
+	if err != nil {
+		return nil, errors.New("Invalid user")
+	}
+
+	//// put it in context
+	ctx = context.WithValue(ctx, userCtxKey, user)
+	ctx = context.WithValue(ctx, sessionCtxKey, session)
+	return ctx, nil
+}
+
 func ForContext(ctx context.Context) *db.UserModel {
 	raw, _ := ctx.Value(userCtxKey).(*db.UserModel)
 	return raw
 }
+
+func SessionForContext(ctx context.Context) *db.SessionModel {
+	raw, _ := ctx.Value(sessionCtxKey).(*db.SessionModel)
+	return raw
+}
+
+// IsSessionActive reports whether a session can still be used to authenticate requests
+func IsSessionActive(session *db.SessionModel) bool {
+	return !session.Revoked && session.ExpiresAt.After(time.Now())
+}
@@ -0,0 +1,40 @@
+package auth
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/awslabs/aws-lambda-go-api-proxy/core"
+)
+
+var ipCtxKey = &contextKey{"ip"}
+
+// clientIP returns the address of the caller. Under Lambda it is the source address seen by API Gateway.
+// Otherwise the X-Forwarded-For header is only read when TRUST_PROXY is set, and only its rightmost entry,
+// which is the one added by the proxy, since the client can write anything before it.
+func clientIP(r *http.Request) string {
+	if gateway, ok := core.GetAPIGatewayContextFromContext(r.Context()); ok && gateway.Identity.SourceIP != "" {
+		return gateway.Identity.SourceIP
+	}
+	if os.Getenv("TRUST_PROXY") == "true" {
+		if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+			hops := strings.Split(forwarded[len(forwarded)-1], ",")
+			if hop := strings.TrimSpace(hops[len(hops)-1]); hop != "" {
+				return hop
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func IPForContext(ctx context.Context) string {
+	raw, _ := ctx.Value(ipCtxKey).(string)
+	return raw
+}
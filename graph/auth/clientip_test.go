@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/awslabs/aws-lambda-go-api-proxy/core"
+)
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		trustProxy bool
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		{"remote address", false, "203.0.113.7:4321", nil, "203.0.113.7"},
+		{"forwarded header is ignored", false, "203.0.113.7:4321", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"proxy hop", true, "10.0.0.2:4321", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"spoofed entries before the proxy hop", true, "10.0.0.2:4321", []string{"1.2.3.4, 198.51.100.1"}, "198.51.100.1"},
+		{"last of several headers", true, "10.0.0.2:4321", []string{"1.2.3.4", "198.51.100.1"}, "198.51.100.1"},
+		{"empty proxy hop", true, "10.0.0.2:4321", []string{"1.2.3.4, "}, "10.0.0.2"},
+		{"remote address without port", false, "203.0.113.7", nil, "203.0.113.7"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.trustProxy {
+				os.Setenv("TRUST_PROXY", "true")
+				defer os.Unsetenv("TRUST_PROXY")
+			}
+			r := httptest.NewRequest(http.MethodPost, "/query", nil)
+			r.RemoteAddr = test.remoteAddr
+			for _, value := range test.forwarded {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+			if got := clientIP(r); got != test.want {
+				t.Errorf("clientIP() = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestClientIPFromAPIGateway(t *testing.T) {
+	event := events.APIGatewayProxyRequest{
+		HTTPMethod: http.MethodPost,
+		Path:       "/query",
+		Headers:    map[string]string{"X-Forwarded-For": "1.2.3.4"},
+		RequestContext: events.APIGatewayProxyRequestContext{
+			Identity: events.APIGatewayRequestIdentity{SourceIP: "198.51.100.1"},
+		},
+	}
+	r, err := (&core.RequestAccessor{}).EventToRequestWithContext(httptest.NewRequest(http.MethodPost, "/", nil).Context(), event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := clientIP(r); got != "198.51.100.1" {
+		t.Errorf("clientIP() = %s, want 198.51.100.1", got)
+	}
+}
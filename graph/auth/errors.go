@@ -0,0 +1,19 @@
+package auth
+
+import "github.com/vektah/gqlparser/v2/gqlerror"
+
+// Forbidden is returned when the user is not allowed to access a resource
+func Forbidden() error {
+	return &gqlerror.Error{
+		Message:    "Access denied",
+		Extensions: map[string]interface{}{"code": "FORBIDDEN"},
+	}
+}
+
+// Unauthenticated is returned when a resource requires the user to be logged in
+func Unauthenticated() error {
+	return &gqlerror.Error{
+		Message:    "Access denied",
+		Extensions: map[string]interface{}{"code": "UNAUTHENTICATED"},
+	}
+}
@@ -0,0 +1,34 @@
+package auth
+
+import "kontrakt-server/prisma/db"
+
+// inheritedRoles lists the roles granted in addition to a user's own role
+var inheritedRoles = map[db.Role][]db.Role{
+	db.RoleADMIN: {db.RoleTEACHER},
+}
+
+// HasRole reports whether the user holds the role, either directly or through the hierarchy
+func HasRole(user *db.UserModel, role db.Role) bool {
+	if user == nil {
+		return false
+	}
+	if user.Role == role {
+		return true
+	}
+	for _, inherited := range inheritedRoles[user.Role] {
+		if inherited == role {
+			return true
+		}
+	}
+	return false
+}
+
+// HasAnyRole reports whether the user holds at least one of the roles
+func HasAnyRole(user *db.UserModel, roles []db.Role) bool {
+	for _, role := range roles {
+		if HasRole(user, role) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package graph
+
+import (
+	"context"
+	"kontrakt-server/graph/auth"
+	"kontrakt-server/prisma/db"
+)
+
+// restrictedStudent returns the username the logged in user is restricted to.
+// Teachers are not restricted; anonymous users are restricted to nothing.
+func restrictedStudent(ctx context.Context) (string, bool) {
+	user := auth.ForContext(ctx)
+	if auth.HasRole(user, db.RoleTEACHER) {
+		return "", false
+	}
+	if user == nil {
+		return "", true
+	}
+	return user.Username, true
+}
+
+// authorizeStudent makes sure the logged in user can read the data of the given student
+func (r *Resolver) authorizeStudent(ctx context.Context, username string) error {
+	if me, restricted := restrictedStudent(ctx); restricted && me != username {
+		return auth.Forbidden()
+	}
+	return nil
+}
+
+// authorizeAccount makes sure the logged in user can manage the sessions and lockout of an account: their own,
+// or one with a lower role, so teachers cannot act on the accounts of other teachers or administrators
+func (r *Resolver) authorizeAccount(ctx context.Context, username string) error {
+	me := auth.ForContext(ctx)
+	if me.Username == username {
+		return nil
+	}
+	user, err := r.Prisma.User.FindUnique(db.User.Username.Equals(username)).Exec(ctx)
+	if err != nil {
+		return err
+	}
+	if auth.HasRole(user, me.Role) {
+		return auth.Forbidden()
+	}
+	return nil
+}
+
+// authorizeContract makes sure the logged in user can read the given contract.
+// Students only read the contracts of their groups that are not archived.
+func (r *Resolver) authorizeContract(ctx context.Context, contractID int) error {
+	me, restricted := restrictedStudent(ctx)
+	if !restricted {
+		return nil
+	}
+	contracts, err := r.Prisma.Contract.FindMany(db.Contract.ID.Equals(contractID), studentContracts(me), db.Contract.Archived.Equals(false)).Exec(ctx)
+	if err != nil {
+		return err
+	}
+	if len(contracts) == 0 {
+		return auth.Forbidden()
+	}
+	return nil
+}
+
+// studentContracts filters contracts assigned to one of the student's groups
+func studentContracts(username string) db.ContractWhereParam {
+	return db.Contract.Groups.Some(db.Group.Students.Some(db.Student.OwnerID.Equals(username)))
+}
+
+// authorizeStudentSkill makes sure the logged in user can access a skill of the given student
+func (r *Resolver) authorizeStudentSkill(ctx context.Context, username string, skillID int) error {
+	if err := r.authorizeStudent(ctx, username); err != nil {
+		return err
+	}
+	skill, err := r.Prisma.Skill.FindUnique(db.Skill.ID.Equals(skillID)).Exec(ctx)
+	if err != nil {
+		return err
+	}
+	return r.authorizeContract(ctx, skill.ContractID)
+}
@@ -0,0 +1,79 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/xuri/excelize/v2"
+	"kontrakt-server/graph/auth"
+	"kontrakt-server/prisma/db"
+	"strings"
+)
+
+const maxCommentLength = 2000
+
+// validateCommentBody trims a comment and makes sure it is neither empty nor too long
+func validateCommentBody(body string) (string, error) {
+	body = strings.TrimSpace(body)
+	if len(body) == 0 {
+		return "", fmt.Errorf("a comment cannot be empty")
+	}
+	if len(body) > maxCommentLength {
+		return "", fmt.Errorf("a comment cannot be longer than %d characters", maxCommentLength)
+	}
+	return body, nil
+}
+
+// threadRootID returns the comment replies to the given parent are attached to.
+// Threads only have one level, so replying to a reply adds to the same thread.
+func (r *Resolver) threadRootID(ctx context.Context, parentID int, studentUsername string, skillID int) (int, error) {
+	parent, err := r.Prisma.StudentSkillComment.FindUnique(db.StudentSkillComment.ID.Equals(parentID)).Exec(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if parent.StudentID != studentUsername || parent.SkillID != skillID {
+		return 0, fmt.Errorf("the parent comment belongs to another student skill")
+	}
+	if rootID, ok := parent.ParentID(); ok {
+		return rootID, nil
+	}
+	return parent.ID, nil
+}
+
+// findOwnComment returns a comment if it was written by the logged in user
+func (r *Resolver) findOwnComment(ctx context.Context, id int) (*db.StudentSkillCommentModel, error) {
+	comment, err := r.Prisma.StudentSkillComment.FindUnique(db.StudentSkillComment.ID.Equals(id)).Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if comment.AuthorID != auth.ForContext(ctx).Username {
+		return nil, auth.Forbidden()
+	}
+	return comment, nil
+}
+
+// latestComments returns the most recent comment written for each student
+func latestComments(comments []db.StudentSkillCommentModel) map[string]db.StudentSkillCommentModel {
+	latest := make(map[string]db.StudentSkillCommentModel)
+	for _, comment := range comments {
+		if previous, ok := latest[comment.StudentID]; !ok || comment.CreatedAt.After(previous.CreatedAt) {
+			latest[comment.StudentID] = comment
+		}
+	}
+	return latest
+}
+
+// addCommentNote attaches a comment as a note on a spreadsheet cell
+func addCommentNote(f *excelize.File, sheet string, axis string, comment db.StudentSkillCommentModel) error {
+	format, err := json.Marshal(struct {
+		Author string `json:"author"`
+		Text   string `json:"text"`
+	}{
+		Author: comment.AuthorID + ": ",
+		Text:   comment.Body,
+	})
+	if err != nil {
+		return err
+	}
+	return f.AddComment(sheet, axis, string(format))
+}
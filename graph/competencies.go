@@ -0,0 +1,115 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"kontrakt-server/graph/model"
+	"kontrakt-server/prisma/db"
+	"sort"
+	"strings"
+)
+
+// validateCompetencyText makes sure a domain or a competency has a code and a name and returns them trimmed
+func validateCompetencyText(code string, name string) (string, string, error) {
+	code, name = strings.TrimSpace(code), strings.TrimSpace(name)
+	if len(code) == 0 {
+		return "", "", fmt.Errorf("a code is needed")
+	}
+	if len(name) == 0 {
+		return "", "", fmt.Errorf("a name is needed")
+	}
+	return code, name, nil
+}
+
+// competencyProgress aggregates the marks a student got on the skills of a competency
+type competencyProgress struct {
+	skillCount    int
+	acquiredCount int
+	marks         map[db.Mark]int
+}
+
+// studentCompetencyProgress aggregates the marks of a student per competency, across the contracts of their groups
+// matching the given parameters. Skills that have not been marked count as TODO.
+// Competencies are returned in the order of the framework, leaving out those no skill targets.
+func (r *Resolver) studentCompetencyProgress(ctx context.Context, username string, contractParams ...db.ContractWhereParam) ([]model.CompetencyProgress, error) {
+	contractParams = append(contractParams, studentContracts(username))
+	skills, err := r.Prisma.Skill.FindMany(db.Skill.Contract.Where(contractParams...)).With(
+		db.Skill.StudentSkills.Fetch(db.StudentSkill.StudentID.Equals(username)),
+		db.Skill.Contract.Fetch().With(db.Contract.MarkScale.Fetch().With(db.MarkScale.Levels.Fetch())),
+	).Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	progress := make(map[int]*competencyProgress)
+	for _, skill := range skills {
+		competencyID, ok := skill.CompetencyID()
+		if !ok {
+			continue
+		}
+		mark := db.MarkTODO
+		if studentSkills := skill.StudentSkills(); len(studentSkills) > 0 {
+			mark = studentSkills[0].Mark
+		}
+		var levels []db.MarkScaleLevelModel
+		if markScale, ok := skill.Contract().MarkScale(); ok {
+			levels = markScale.Levels()
+		}
+		competency, ok := progress[competencyID]
+		if !ok {
+			competency = &competencyProgress{marks: make(map[db.Mark]int)}
+			progress[competencyID] = competency
+		}
+		competency.skillCount++
+		competency.marks[mark]++
+		if isAcquired(levels, mark) {
+			competency.acquiredCount++
+		}
+	}
+	if len(progress) == 0 {
+		return []model.CompetencyProgress{}, nil
+	}
+
+	var competencyIDs []int
+	for id := range progress {
+		competencyIDs = append(competencyIDs, id)
+	}
+	competencies, err := r.Prisma.Competency.FindMany(db.Competency.ID.In(competencyIDs)).With(db.Competency.Domain.Fetch()).Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sortCompetencies(competencies)
+	results := make([]model.CompetencyProgress, 0, len(competencies))
+	for i := range competencies {
+		competency := progress[competencies[i].ID]
+		var markCounts []model.MarkCount
+		for _, mark := range model.AllMark {
+			if count := competency.marks[db.Mark(mark)]; count > 0 {
+				markCounts = append(markCounts, model.MarkCount{Mark: mark, Count: count})
+			}
+		}
+		results = append(results, model.CompetencyProgress{
+			Competency:    &competencies[i],
+			SkillCount:    competency.skillCount,
+			AcquiredCount: competency.acquiredCount,
+			MarkCounts:    markCounts,
+		})
+	}
+	return results, nil
+}
+
+// sortCompetencies sorts competencies in the order of the framework, their domain must have been fetched
+func sortCompetencies(competencies []db.CompetencyModel) {
+	sort.SliceStable(competencies, func(i, j int) bool {
+		a, b := competencies[i], competencies[j]
+		if a.Domain().Position != b.Domain().Position {
+			return a.Domain().Position < b.Domain().Position
+		}
+		if a.DomainID != b.DomainID {
+			return a.DomainID < b.DomainID
+		}
+		if a.Position != b.Position {
+			return a.Position < b.Position
+		}
+		return a.ID < b.ID
+	})
+}
@@ -0,0 +1,294 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"kontrakt-server/graph/model"
+	"kontrakt-server/prisma/db"
+	"kontrakt-server/utils"
+	"strings"
+	"time"
+
+	"github.com/prisma/prisma-client-go/runtime/transaction"
+)
+
+// validateContractDates makes sure a contract does not end before it starts
+func validateContractDates(start time.Time, end time.Time) error {
+	if end.Before(start) {
+		return fmt.Errorf("a contract cannot end before it starts")
+	}
+	return nil
+}
+
+// validateContractColor makes sure a color is valid and not used by another contract
+func (r *Resolver) validateContractColor(ctx context.Context, contractID int, hexColor string) error {
+	if !hexColorRegexp.MatchString(hexColor) {
+		return fmt.Errorf("invalid color %s", hexColor)
+	}
+	others, err := r.Prisma.Contract.FindMany(db.Contract.HexColor.Equals(hexColor), db.Contract.Not(db.Contract.ID.Equals(contractID))).Exec(ctx)
+	if err != nil {
+		return err
+	}
+	if len(others) > 0 {
+		return fmt.Errorf("the color %s is already used by %s", hexColor, others[0].Name)
+	}
+	return nil
+}
+
+// unusedContractColor picks a random color that no contract uses yet
+func (r *Resolver) unusedContractColor(ctx context.Context) (string, error) {
+	for attempt := 0; attempt < 10; attempt++ {
+		token, err := utils.RandomToken(3)
+		if err != nil {
+			return "", err
+		}
+		hexColor := "#" + token
+		used, err := r.Prisma.Contract.FindMany(db.Contract.HexColor.Equals(hexColor)).Exec(ctx)
+		if err != nil {
+			return "", err
+		}
+		if len(used) == 0 {
+			return hexColor, nil
+		}
+	}
+	return "", fmt.Errorf("could not find an unused color, please pick one")
+}
+
+// skillCategoryLink links the skill at a position of a new contract to one of its categories.
+// The client cannot create nested records, so the contract, which does not have an id yet, is found by its unique color.
+const skillCategoryLink = `UPDATE "Skill" SET "categoryID" = "SkillCategory"."id" FROM "SkillCategory", "Contract"
+WHERE "Contract"."hexColor" = $1 AND "Skill"."contractId" = "Contract"."id" AND "SkillCategory"."contractID" = "Contract"."id"
+AND "SkillCategory"."name" = $2 AND "Skill"."position" = $3`
+
+// createContract creates a contract linked to the given groups along with its skills, in the given order.
+// Categories are created in the order they first appear in. A color is picked when none is given.
+// Everything is checked first and created in a single transaction, so a failure does not leave a partial contract.
+func (r *Resolver) createContract(ctx context.Context, name string, hexColor *string, start time.Time, end time.Time, markScaleID *int, groupIDs []int, skills []newSkill) (*db.ContractModel, error) {
+	if err := validateContractDates(start, end); err != nil {
+		return nil, err
+	}
+	var color string
+	if hexColor != nil {
+		if err := r.validateContractColor(ctx, 0, *hexColor); err != nil {
+			return nil, err
+		}
+		color = *hexColor
+	} else {
+		var err error
+		if color, err = r.unusedContractColor(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if err := r.checkContractReferences(ctx, markScaleID, groupIDs, skills); err != nil {
+		return nil, err
+	}
+	categoryNames := make([]string, len(skills))
+	for position, skill := range skills {
+		if skill.category != nil {
+			category, err := validateCategoryName(*skill.category)
+			if err != nil {
+				return nil, err
+			}
+			categoryNames[position] = category
+		}
+	}
+
+	var param []db.ContractSetParam
+	if markScaleID != nil {
+		param = append(param, db.Contract.MarkScale.Link(db.MarkScale.ID.Equals(*markScaleID)))
+	}
+	created := r.Prisma.Contract.CreateOne(
+		db.Contract.End.Set(end),
+		db.Contract.Name.Set(name),
+		db.Contract.HexColor.Set(color),
+		db.Contract.Start.Set(start),
+		param...,
+	).Tx()
+	contract := db.Contract.HexColor.Equals(color)
+	transactions := []transaction.Param{created}
+	for _, groupID := range uniqueIDs(groupIDs) {
+		transactions = append(transactions, r.Prisma.Group.FindUnique(db.Group.ID.Equals(groupID)).Update(db.Group.Contracts.Link(contract)).Tx())
+	}
+	categories := make(map[string]bool)
+	var links []transaction.Param
+	for position, skill := range skills {
+		param := []db.SkillSetParam{db.Skill.Position.Set(position), db.Skill.Description.SetIfPresent(skill.description)}
+		if category := categoryNames[position]; category != "" {
+			if !categories[category] {
+				transactions = append(transactions, r.Prisma.SkillCategory.CreateOne(db.SkillCategory.Contract.Link(contract), db.SkillCategory.Name.Set(category), db.SkillCategory.Position.Set(len(categories))).Tx())
+				categories[category] = true
+			}
+			links = append(links, r.Prisma.Prisma.ExecuteRaw(skillCategoryLink, color, category, position).Tx())
+		}
+		if skill.competencyID != nil {
+			param = append(param, db.Skill.Competency.Link(db.Competency.ID.Equals(*skill.competencyID)))
+		}
+		transactions = append(transactions, r.Prisma.Skill.CreateOne(db.Skill.Name.Set(skill.name), db.Skill.Contract.Link(contract), param...).Tx())
+	}
+	if err := r.Prisma.Prisma.Transaction(append(transactions, links...)...).Exec(ctx); err != nil {
+		return nil, err
+	}
+	return created.Result(), nil
+}
+
+// checkContractReferences makes sure the mark scale, groups and competencies a new contract refers to exist
+func (r *Resolver) checkContractReferences(ctx context.Context, markScaleID *int, groupIDs []int, skills []newSkill) error {
+	if markScaleID != nil {
+		if _, err := r.Prisma.MarkScale.FindUnique(db.MarkScale.ID.Equals(*markScaleID)).Exec(ctx); err != nil {
+			return fmt.Errorf("mark scale %d: %w", *markScaleID, err)
+		}
+	}
+	if groupIDs = uniqueIDs(groupIDs); len(groupIDs) > 0 {
+		groups, err := r.Prisma.Group.FindMany(db.Group.ID.In(groupIDs)).Exec(ctx)
+		if err != nil {
+			return err
+		}
+		if len(groups) != len(groupIDs) {
+			return fmt.Errorf("some of the groups do not exist")
+		}
+	}
+	var competencyIDs []int
+	for _, skill := range skills {
+		if skill.competencyID != nil {
+			competencyIDs = append(competencyIDs, *skill.competencyID)
+		}
+	}
+	if competencyIDs = uniqueIDs(competencyIDs); len(competencyIDs) > 0 {
+		competencies, err := r.Prisma.Competency.FindMany(db.Competency.ID.In(competencyIDs)).Exec(ctx)
+		if err != nil {
+			return err
+		}
+		if len(competencies) != len(competencyIDs) {
+			return fmt.Errorf("some of the competencies do not exist")
+		}
+	}
+	return nil
+}
+
+// uniqueIDs returns ids without duplicates, in the order they first appear in
+func uniqueIDs(ids []int) []int {
+	seen := make(map[int]bool)
+	var unique []int
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
+
+// contractGroupChanges returns the transactions linking a contract to exactly the given groups
+func (r *Resolver) contractGroupChanges(ctx context.Context, contractID int, groupIDs []int) ([]transaction.Param, error) {
+	toLink, err := r.Prisma.Group.FindMany(db.Group.ID.In(groupIDs), db.Group.Not(db.Group.Contracts.Some(db.Contract.ID.Equals(contractID)))).Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	toUnLink, err := r.Prisma.Group.FindMany(db.Group.Not(db.Group.ID.In(groupIDs)), db.Group.Contracts.Some(db.Contract.ID.Equals(contractID))).Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var transactions []transaction.Param
+	for _, groupModel := range toUnLink {
+		transactions = append(transactions, r.Prisma.Group.FindUnique(db.Group.ID.Equals(groupModel.ID)).Update(db.Group.Contracts.Unlink(db.Contract.ID.Equals(contractID))).Tx())
+	}
+	for _, groupModel := range toLink {
+		transactions = append(transactions, r.Prisma.Group.FindUnique(db.Group.ID.Equals(groupModel.ID)).Update(db.Group.Contracts.Link(db.Contract.ID.Equals(contractID))).Tx())
+	}
+	return transactions, nil
+}
+
+// contractSkillChanges returns the transactions making the skills of a contract match the given list.
+// Skills with an id are updated, skills without one are created and skills left out are deleted;
+// the list order becomes the position of the skills.
+// The storage keys of the attachments of deleted skills are returned to be removed once committed.
+func (r *Resolver) contractSkillChanges(ctx context.Context, contract *db.ContractModel, skills []model.ContractSkillInput) ([]transaction.Param, []string, error) {
+	existing := make(map[int]bool)
+	for _, skill := range contract.Skills() {
+		existing[skill.ID] = true
+	}
+	kept := make(map[int]bool)
+	var transactions []transaction.Param
+	for position, skill := range skills {
+		name := strings.TrimSpace(skill.Name)
+		if len(name) == 0 {
+			return nil, nil, fmt.Errorf("skill %d needs a name", position+1)
+		}
+		if skill.ID == nil {
+			transactions = append(transactions, r.Prisma.Skill.CreateOne(db.Skill.Name.Set(name), db.Skill.Contract.Link(db.Contract.ID.Equals(contract.ID)), db.Skill.Position.Set(position), db.Skill.Description.SetIfPresent(skill.Description)).Tx())
+			continue
+		}
+		if !existing[*skill.ID] {
+			return nil, nil, fmt.Errorf("skill %d does not belong to %s", *skill.ID, contract.Name)
+		}
+		if kept[*skill.ID] {
+			return nil, nil, fmt.Errorf("skill %d is listed more than once", *skill.ID)
+		}
+		kept[*skill.ID] = true
+		transactions = append(transactions, r.Prisma.Skill.FindUnique(db.Skill.ID.Equals(*skill.ID)).Update(db.Skill.Name.Set(name), db.Skill.Position.Set(position), db.Skill.Description.SetIfPresent(skill.Description)).Tx())
+	}
+	var removed []int
+	for _, skill := range contract.Skills() {
+		if !kept[skill.ID] {
+			removed = append(removed, skill.ID)
+		}
+	}
+	deletions, storageKeys, err := r.skillDeletion(ctx, removed)
+	if err != nil {
+		return nil, nil, err
+	}
+	return append(deletions, transactions...), storageKeys, nil
+}
+
+// skillDeletion returns the transactions deleting skills along with the marks, history, comments,
+// self-assessments and attachments of students on them.
+// The storage keys of the attachments are returned to be removed once committed.
+func (r *Resolver) skillDeletion(ctx context.Context, skillIDs []int) ([]transaction.Param, []string, error) {
+	if len(skillIDs) == 0 {
+		return nil, nil, nil
+	}
+	attachments, err := r.Prisma.Attachment.FindMany(db.Attachment.SkillID.In(skillIDs)).Exec(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	var storageKeys []string
+	for _, attachment := range attachments {
+		storageKeys = append(storageKeys, attachment.StorageKey)
+	}
+	return []transaction.Param{
+		r.Prisma.Attachment.FindMany(db.Attachment.SkillID.In(skillIDs)).Delete().Tx(),
+		r.Prisma.SelfAssessment.FindMany(db.SelfAssessment.SkillID.In(skillIDs)).Delete().Tx(),
+		r.Prisma.StudentSkillComment.FindMany(db.StudentSkillComment.SkillID.In(skillIDs)).Delete().Tx(),
+		r.Prisma.StudentSkillEvent.FindMany(db.StudentSkillEvent.SkillID.In(skillIDs)).Delete().Tx(),
+		r.Prisma.StudentSkill.FindMany(db.StudentSkill.SkillID.In(skillIDs)).Delete().Tx(),
+		r.Prisma.Skill.FindMany(db.Skill.ID.In(skillIDs)).Delete().Tx(),
+	}, storageKeys, nil
+}
+
+// deleteStoredFiles removes files from the storage once nothing references them anymore
+func (r *Resolver) deleteStoredFiles(ctx context.Context, storageKeys []string) error {
+	for _, key := range storageKeys {
+		if err := r.Storage.Delete(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// groupMembershipClearing returns the transactions removing every student from their groups
+// and the number of groups that had students
+func (r *Resolver) groupMembershipClearing(ctx context.Context) ([]transaction.Param, int, error) {
+	groups, err := r.Prisma.Group.FindMany(db.Group.Students.Some()).With(db.Group.Students.Fetch()).Exec(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	var transactions []transaction.Param
+	for _, group := range groups {
+		var students []db.StudentWhereParam
+		for _, student := range group.Students() {
+			students = append(students, db.Student.OwnerID.Equals(student.OwnerID))
+		}
+		transactions = append(transactions, r.Prisma.Group.FindUnique(db.Group.ID.Equals(group.ID)).Update(db.Group.Students.Unlink(students...)).Tx())
+	}
+	return transactions, len(groups), nil
+}
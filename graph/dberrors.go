@@ -0,0 +1,9 @@
+package graph
+
+import "strings"
+
+// isUniqueViolation reports whether a write failed on a unique constraint, which the client only tells in its message.
+// Values are checked before writing, this catches the ones taken in between.
+func isUniqueViolation(err error) bool {
+	return err != nil && (strings.Contains(err.Error(), "P2002") || strings.Contains(err.Error(), "Unique constraint failed"))
+}
@@ -0,0 +1,373 @@
+package graph
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"kontrakt-server/graph/auth"
+	"kontrakt-server/graph/model"
+	"kontrakt-server/prisma/db"
+	"kontrakt-server/storage"
+	"kontrakt-server/utils"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/xuri/excelize/v2"
+)
+
+const (
+	exportURLDuration      = 15 * time.Minute
+	exportDownloadDuration = time.Minute
+	exportStorageKeyPrefix = "export-"
+	exportIDEntropy        = 16
+	maxSheetNameLength     = 31
+	spreadsheetContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+)
+
+func exportPath(id string) string {
+	return "/exports/" + id
+}
+
+// createExport records an export requested by the logged in user and returns a short-lived signed link to download it.
+// The file is only built when it is downloaded. Empty lists of contracts or groups do not limit the export.
+func (r *Resolver) createExport(ctx context.Context, contractIDs []int, groupIDs []int, period *model.DateRange, archived *bool, sheetPerGroup bool) (string, error) {
+	from, to, err := dateRange(period)
+	if err != nil {
+		return "", err
+	}
+	// Expired exports cannot be downloaded anymore
+	if _, err := r.Prisma.Export.FindMany(db.Export.ExpiresAt.Before(time.Now())).Delete().Exec(ctx); err != nil {
+		return "", err
+	}
+	id, err := utils.RandomToken(exportIDEntropy)
+	if err != nil {
+		return "", err
+	}
+	if contractIDs == nil {
+		contractIDs = []int{}
+	}
+	if groupIDs == nil {
+		groupIDs = []int{}
+	}
+	expiresAt := time.Now().Add(exportURLDuration)
+	_, err = r.Prisma.Export.CreateOne(
+		db.Export.ID.Set(id),
+		db.Export.Requester.Link(db.User.Username.Equals(auth.ForContext(ctx).Username)),
+		db.Export.ExpiresAt.Set(expiresAt),
+		db.Export.ContractIDs.Set(contractIDs),
+		db.Export.GroupIDs.Set(groupIDs),
+		db.Export.PeriodFrom.SetIfPresent(from),
+		db.Export.PeriodTo.SetIfPresent(to),
+		db.Export.Archived.SetIfPresent(archived),
+		db.Export.SheetPerGroup.Set(sheetPerGroup),
+	).Exec(ctx)
+	if err != nil {
+		return "", err
+	}
+	return utils.SignURL(exportPath(id), expiresAt), nil
+}
+
+// ExportHandler sends exports to whoever holds a valid signed link.
+// When files are kept in a bucket the export is saved there and downloaded from it,
+// as Lambda responses cannot be larger than a few megabytes.
+func (r *Resolver) ExportHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		id := mux.Vars(req)["id"]
+		if err := utils.VerifySignedURL(exportPath(id), req.URL.Query()); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		export, err := r.Prisma.Export.FindUnique(db.Export.ID.Equals(id)).Exec(req.Context())
+		if errors.Is(err, db.ErrNotFound) {
+			http.NotFound(w, req)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		f, err := r.buildSpreadsheet(req.Context(), *export)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// The workbook is written before anything is sent so a failure still gets an error status
+		var content bytes.Buffer
+		if err := f.Write(&content); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		filename := fmt.Sprintf("kontrakt-%s.xlsx", export.CreatedAt.Format("2006-01-02"))
+		if presigner, ok := r.Storage.(storage.Presigner); ok {
+			link, err := r.saveExport(req.Context(), presigner, export.ID, filename, &content)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			http.Redirect(w, req, link, http.StatusSeeOther)
+			return
+		}
+		w.Header().Set("Content-Type", spreadsheetContentType)
+		w.Header().Set("Content-Length", strconv.Itoa(content.Len()))
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+		w.Header().Set("Cache-Control", "no-store")
+		content.WriteTo(w)
+	})
+}
+
+// saveExport stores a built export and returns a link downloading it.
+// The bucket deletes stored exports after a day.
+func (r *Resolver) saveExport(ctx context.Context, presigner storage.Presigner, id string, filename string, content io.Reader) (string, error) {
+	key := exportStorageKeyPrefix + id + ".xlsx"
+	if err := r.Storage.Save(ctx, key, content); err != nil {
+		return "", err
+	}
+	return presigner.PresignGet(key, spreadsheetContentType, mime.FormatMediaType("attachment", map[string]string{"filename": filename}), exportDownloadDuration)
+}
+
+// buildSpreadsheet returns a workbook listing the marks of students within the scope of an export,
+// with a sheet per contract or, when asked, a sheet per group with the contracts of the group side by side
+func (r *Resolver) buildSpreadsheet(ctx context.Context, export db.ExportModel) (*excelize.File, error) {
+	var params []db.ContractWhereParam
+	if len(export.ContractIDs) > 0 {
+		params = append(params, db.Contract.ID.In(export.ContractIDs))
+	}
+	if len(export.GroupIDs) > 0 {
+		params = append(params, db.Contract.Groups.Some(db.Group.ID.In(export.GroupIDs)))
+	}
+	if archived, ok := export.Archived(); ok {
+		params = append(params, db.Contract.Archived.Equals(archived))
+	}
+	// Contracts overlapping the period are exported
+	params = append(params, db.Contract.Start.BeforeEqualsIfPresent(export.InnerExport.PeriodTo), db.Contract.End.AfterEqualsIfPresent(export.InnerExport.PeriodFrom))
+	contracts, err := r.Prisma.Contract.FindMany(params...).OrderBy(db.Contract.Start.Order(db.SortOrderAsc), db.Contract.ID.Order(db.SortOrderAsc)).With(db.Contract.Skills.Fetch().OrderBy(db.Skill.Position.Order(db.SortOrderAsc), db.Skill.ID.Order(db.SortOrderAsc)).With(db.Skill.StudentSkills.Fetch(), db.Skill.Comments.Fetch()), db.Contract.Categories.Fetch().OrderBy(db.SkillCategory.Position.Order(db.SortOrderAsc), db.SkillCategory.ID.Order(db.SortOrderAsc)), db.Contract.Groups.Fetch().With(db.Group.Students.Fetch()), db.Contract.MarkScale.Fetch().With(db.MarkScale.Levels.Fetch())).Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	inScope := func(groupID int) bool {
+		if len(export.GroupIDs) == 0 {
+			return true
+		}
+		for _, id := range export.GroupIDs {
+			if id == groupID {
+				return true
+			}
+		}
+		return false
+	}
+
+	f := excelize.NewFile()
+	defaultSheet := f.GetSheetName(0)
+	// The default sheet name is taken so a contract or group with the same name does not end up in it and get deleted
+	sheets := map[string]bool{strings.ToLower(defaultSheet): true}
+	if export.SheetPerGroup {
+		groups := make(map[int]db.GroupModel)
+		groupContracts := make(map[int][]db.ContractModel)
+		for _, contract := range contracts {
+			for _, group := range contract.Groups() {
+				if inScope(group.ID) {
+					groups[group.ID] = group
+					groupContracts[group.ID] = append(groupContracts[group.ID], contract)
+				}
+			}
+		}
+		var orderedGroups []db.GroupModel
+		for _, group := range groups {
+			orderedGroups = append(orderedGroups, group)
+		}
+		sort.Slice(orderedGroups, func(i, j int) bool {
+			if orderedGroups[i].Name != orderedGroups[j].Name {
+				return orderedGroups[i].Name < orderedGroups[j].Name
+			}
+			return orderedGroups[i].ID < orderedGroups[j].ID
+		})
+		for _, group := range orderedGroups {
+			err := writeMarkSheet(f, sheetName(group.Name, sheets), sortedStudents(group.Students()), groupContracts[group.ID], true)
+			if err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		for _, contract := range contracts {
+			students := make(map[string]db.StudentModel)
+			for _, group := range contract.Groups() {
+				if !inScope(group.ID) {
+					continue
+				}
+				for _, student := range group.Students() {
+					students[student.OwnerID] = student
+				}
+			}
+			var studentList []db.StudentModel
+			for _, student := range students {
+				studentList = append(studentList, student)
+			}
+			err := writeMarkSheet(f, sheetName(contract.Name, sheets), sortedStudents(studentList), []db.ContractModel{contract}, false)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	// The default sheet is kept when nothing matches the scope so the workbook stays valid
+	if len(sheets) > 1 {
+		f.DeleteSheet(defaultSheet)
+		f.SetActiveSheet(0)
+	}
+	return f, nil
+}
+
+// sortedStudents orders students by name
+func sortedStudents(students []db.StudentModel) []db.StudentModel {
+	sorted := append([]db.StudentModel(nil), students...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].LastName != sorted[j].LastName {
+			return sorted[i].LastName < sorted[j].LastName
+		}
+		if sorted[i].FirstName != sorted[j].FirstName {
+			return sorted[i].FirstName < sorted[j].FirstName
+		}
+		return sorted[i].OwnerID < sorted[j].OwnerID
+	})
+	return sorted
+}
+
+// sheetName makes a name usable as a sheet name, which spreadsheet software limits to 31 characters
+// without some symbols, and different from the names already used
+func sheetName(name string, used map[string]bool) string {
+	name = strings.TrimSpace(strings.NewReplacer("[", "(", "]", ")", ":", "-", "*", "-", "?", "", "/", "-", "\\", "-").Replace(name))
+	if len(name) == 0 {
+		name = "Feuille"
+	}
+	truncate := func(name string, length int) string {
+		if runes := []rune(name); len(runes) > length {
+			return strings.TrimSpace(string(runes[:length]))
+		}
+		return name
+	}
+	unique := truncate(name, maxSheetNameLength)
+	for i := 2; used[strings.ToLower(unique)]; i++ {
+		suffix := fmt.Sprintf(" (%d)", i)
+		unique = truncate(name, maxSheetNameLength-len(suffix)) + suffix
+	}
+	used[strings.ToLower(unique)] = true
+	return unique
+}
+
+// mergeHeader writes a header spanning columns of a row
+func mergeHeader(f *excelize.File, sheet string, row int, column int, width int, value string) error {
+	first, err := excelize.CoordinatesToCellName(column, row)
+	if err != nil {
+		return err
+	}
+	last, err := excelize.CoordinatesToCellName(column+width-1, row)
+	if err != nil {
+		return err
+	}
+	if err := f.SetCellValue(sheet, first, value); err != nil {
+		return err
+	}
+	return f.MergeCell(sheet, first, last)
+}
+
+// writeMarkSheet adds a sheet with a row per student and a column per skill of the contracts.
+// Skills are grouped under their contract when contractHeader is set and under their category when contracts have some.
+func writeMarkSheet(f *excelize.File, sheet string, students []db.StudentModel, contracts []db.ContractModel, contractHeader bool) error {
+	f.NewSheet(sheet)
+	headerRow, contractRow, categoryRow := 1, 0, 0
+	if contractHeader {
+		contractRow = headerRow
+		headerRow++
+	}
+	for _, contract := range contracts {
+		if len(contract.Categories()) > 0 {
+			categoryRow = headerRow
+			headerRow++
+			break
+		}
+	}
+	axis, err := excelize.CoordinatesToCellName(1, headerRow)
+	if err != nil {
+		return err
+	}
+	if err := f.SetCellValue(sheet, axis, "Élèves"); err != nil {
+		return err
+	}
+	for i, student := range students {
+		axis, err := excelize.CoordinatesToCellName(1, headerRow+1+i)
+		if err != nil {
+			return err
+		}
+		if err := f.SetCellValue(sheet, axis, student.FirstName+" "+student.LastName); err != nil {
+			return err
+		}
+	}
+
+	column := 2
+	for _, contract := range contracts {
+		var levels []db.MarkScaleLevelModel
+		if markScale, ok := contract.MarkScale(); ok {
+			levels = markScale.Levels()
+		}
+		if contractRow > 0 && len(contract.Skills()) > 0 {
+			if err := mergeHeader(f, sheet, contractRow, column, len(contract.Skills()), contract.Name); err != nil {
+				return err
+			}
+		}
+		for _, group := range skillColumnGroups(contract.Skills(), contract.Categories()) {
+			if categoryRow > 0 && group.category != "" {
+				if err := mergeHeader(f, sheet, categoryRow, column, len(group.skills), group.category); err != nil {
+					return err
+				}
+			}
+			for _, skill := range group.skills {
+				axis, err := excelize.CoordinatesToCellName(column, headerRow)
+				if err != nil {
+					return err
+				}
+				if err := f.SetCellValue(sheet, axis, skill.Name); err != nil {
+					return err
+				}
+				marks := make(map[string]db.Mark)
+				for _, studentSkill := range skill.StudentSkills() {
+					marks[studentSkill.StudentID] = studentSkill.Mark
+				}
+				comments := latestComments(skill.Comments())
+				for i, student := range students {
+					axis, err := excelize.CoordinatesToCellName(column, headerRow+1+i)
+					if err != nil {
+						return err
+					}
+					mark, ok := marks[student.OwnerID]
+					if !ok {
+						mark = db.MarkTODO
+					}
+					markData := utils.GetScaleMarkData(levels, mark)
+					if err := f.SetCellValue(sheet, axis, markData.Text); err != nil {
+						return err
+					}
+					style, err := f.NewStyle(markData.Style)
+					if err != nil {
+						return err
+					}
+					if err := f.SetCellStyle(sheet, axis, axis, style); err != nil {
+						return err
+					}
+					if comment, ok := comments[student.OwnerID]; ok {
+						if err := addCommentNote(f, sheet, axis, comment); err != nil {
+							return err
+						}
+					}
+				}
+				column++
+			}
+		}
+	}
+	return nil
+}
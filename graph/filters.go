@@ -0,0 +1,234 @@
+package graph
+
+import (
+	"fmt"
+	"kontrakt-server/graph/model"
+	"kontrakt-server/prisma/db"
+	"sort"
+	"time"
+)
+
+func sortOrder(direction model.SortDirection) db.SortOrder {
+	if direction == model.SortDirectionDesc {
+		return db.SortOrderDesc
+	}
+	return db.SortOrderAsc
+}
+
+// dateRange returns the optional bounds of a range of days
+func dateRange(dates *model.DateRange) (from *time.Time, to *time.Time, err error) {
+	if dates == nil {
+		return nil, nil, nil
+	}
+	if dates.From != nil && dates.To != nil && dates.To.Before(*dates.From) {
+		return nil, nil, fmt.Errorf("a date range cannot end before it starts")
+	}
+	return dates.From, dates.To, nil
+}
+
+func contractWhere(filter *model.ContractFilter) ([]db.ContractWhereParam, error) {
+	var params []db.ContractWhereParam
+	if filter == nil {
+		return params, nil
+	}
+	if filter.NameContains != nil {
+		params = append(params, db.Contract.Name.Contains(*filter.NameContains), db.Contract.Name.Mode(db.QueryModeInsensitive))
+	}
+	if filter.Archived != nil {
+		params = append(params, db.Contract.Archived.Equals(*filter.Archived))
+	}
+	if filter.Active != nil {
+		today := time.Now().Truncate(24 * time.Hour)
+		active := db.Contract.And(db.Contract.Start.BeforeEquals(today), db.Contract.End.AfterEquals(today))
+		if *filter.Active {
+			params = append(params, active)
+		} else {
+			params = append(params, db.Contract.Not(active))
+		}
+	}
+	startFrom, startTo, err := dateRange(filter.Start)
+	if err != nil {
+		return nil, err
+	}
+	endFrom, endTo, err := dateRange(filter.End)
+	if err != nil {
+		return nil, err
+	}
+	params = append(params,
+		db.Contract.Start.AfterEqualsIfPresent(startFrom),
+		db.Contract.Start.BeforeEqualsIfPresent(startTo),
+		db.Contract.End.AfterEqualsIfPresent(endFrom),
+		db.Contract.End.BeforeEqualsIfPresent(endTo),
+	)
+	if filter.GroupIDs != nil {
+		params = append(params, db.Contract.Groups.Some(db.Group.ID.In(filter.GroupIDs)))
+	}
+	return params, nil
+}
+
+func skillWhere(filter *model.SkillFilter) ([]db.SkillWhereParam, error) {
+	var params []db.SkillWhereParam
+	if filter == nil {
+		return params, nil
+	}
+	if filter.NameContains != nil {
+		params = append(params, db.Skill.Name.Contains(*filter.NameContains), db.Skill.Name.Mode(db.QueryModeInsensitive))
+	}
+	if filter.Contract != nil {
+		contractParams, err := contractWhere(filter.Contract)
+		if err != nil {
+			return nil, err
+		}
+		params = append(params, db.Skill.Contract.Where(contractParams...))
+	}
+	return params, nil
+}
+
+func studentSkillWhere(filter *model.StudentSkillFilter) ([]db.StudentSkillWhereParam, error) {
+	var params []db.StudentSkillWhereParam
+	if filter == nil {
+		return params, nil
+	}
+	if filter.MarksIn != nil {
+		var marks []db.Mark
+		for _, mark := range filter.MarksIn {
+			marks = append(marks, db.Mark(mark))
+		}
+		params = append(params, db.StudentSkill.Mark.In(marks))
+	}
+	if filter.Skill != nil {
+		skillParams, err := skillWhere(filter.Skill)
+		if err != nil {
+			return nil, err
+		}
+		params = append(params, db.StudentSkill.Skill.Where(skillParams...))
+	}
+	return params, nil
+}
+
+func studentWhere(filter *model.StudentFilter) ([]db.StudentWhereParam, error) {
+	var params []db.StudentWhereParam
+	if filter == nil {
+		return params, nil
+	}
+	if filter.NameContains != nil {
+		params = append(params, db.Student.Or(
+			db.Student.And(db.Student.FirstName.Contains(*filter.NameContains), db.Student.FirstName.Mode(db.QueryModeInsensitive)),
+			db.Student.And(db.Student.LastName.Contains(*filter.NameContains), db.Student.LastName.Mode(db.QueryModeInsensitive)),
+			db.Student.OwnerID.Contains(*filter.NameContains),
+		))
+	}
+	if filter.GroupIDs != nil {
+		params = append(params, db.Student.Groups.Some(db.Group.ID.In(filter.GroupIDs)))
+	}
+	if filter.ContractID != nil {
+		params = append(params, db.Student.Groups.Some(db.Group.Contracts.Some(db.Contract.ID.Equals(*filter.ContractID))))
+	}
+	if filter.HasStudentSkill != nil {
+		studentSkillParams, err := studentSkillWhere(filter.HasStudentSkill)
+		if err != nil {
+			return nil, err
+		}
+		params = append(params, db.Student.StudentSkills.Some(studentSkillParams...))
+	}
+	return params, nil
+}
+
+// contractOrder sorts contracts for a page, by id unless asked otherwise
+func contractOrder(orderBy *model.ContractOrderBy, p page) []db.ContractOrderByParam {
+	if orderBy == nil {
+		return []db.ContractOrderByParam{db.Contract.ID.Order(p.direction(db.SortOrderAsc))}
+	}
+	direction := p.direction(sortOrder(orderBy.Direction))
+	var field db.ContractOrderByParam
+	switch orderBy.Field {
+	case model.ContractOrderFieldName:
+		field = db.Contract.Name.Order(direction)
+	case model.ContractOrderFieldStart:
+		field = db.Contract.Start.Order(direction)
+	case model.ContractOrderFieldEnd:
+		field = db.Contract.End.Order(direction)
+	default:
+		return []db.ContractOrderByParam{db.Contract.ID.Order(direction)}
+	}
+	// The id keeps the order stable between contracts sharing the same value
+	return []db.ContractOrderByParam{field, db.Contract.ID.Order(direction)}
+}
+
+// skillOrder sorts skills for a page, in the order of the contract unless asked otherwise
+func skillOrder(orderBy *model.SkillOrderBy, p page) []db.SkillOrderByParam {
+	if orderBy == nil {
+		direction := p.direction(db.SortOrderAsc)
+		return []db.SkillOrderByParam{db.Skill.Position.Order(direction), db.Skill.ID.Order(direction)}
+	}
+	direction := p.direction(sortOrder(orderBy.Direction))
+	switch orderBy.Field {
+	case model.SkillOrderFieldName:
+		return []db.SkillOrderByParam{db.Skill.Name.Order(direction), db.Skill.ID.Order(direction)}
+	case model.SkillOrderFieldPosition:
+		return []db.SkillOrderByParam{db.Skill.Position.Order(direction), db.Skill.ID.Order(direction)}
+	default:
+		return []db.SkillOrderByParam{db.Skill.ID.Order(direction)}
+	}
+}
+
+func studentOrder(orderBy *model.StudentOrderBy, p page) []db.StudentOrderByParam {
+	if orderBy == nil {
+		return []db.StudentOrderByParam{db.Student.OwnerID.Order(p.direction(db.SortOrderAsc))}
+	}
+	direction := p.direction(sortOrder(orderBy.Direction))
+	switch orderBy.Field {
+	case model.StudentOrderFieldFirstName:
+		return []db.StudentOrderByParam{db.Student.FirstName.Order(direction), db.Student.LastName.Order(direction), db.Student.OwnerID.Order(direction)}
+	case model.StudentOrderFieldLastName:
+		return []db.StudentOrderByParam{db.Student.LastName.Order(direction), db.Student.FirstName.Order(direction), db.Student.OwnerID.Order(direction)}
+	default:
+		return []db.StudentOrderByParam{db.Student.OwnerID.Order(direction)}
+	}
+}
+
+// markRank follows the declaration order of the Mark enum, which is how the database sorts marks
+var markRank = map[db.Mark]int{
+	db.MarkTODO:      0,
+	db.MarkTOFINISH:  1,
+	db.MarkTOCORRECT: 2,
+	db.MarkGOOD:      3,
+	db.MarkVERYGOOD:  4,
+	db.MarkBAD:       5,
+	db.MarkVERYBAD:   6,
+}
+
+// sortStudentSkills sorts student skills in place, by skill unless asked otherwise
+func sortStudentSkills(studentSkills []db.StudentSkillModel, orderBy *model.StudentSkillOrderBy) {
+	field := model.StudentSkillOrderFieldSkillID
+	direction := model.SortDirectionAsc
+	if orderBy != nil {
+		field = orderBy.Field
+		direction = orderBy.Direction
+	}
+	less := func(a db.StudentSkillModel, b db.StudentSkillModel) bool {
+		if field == model.StudentSkillOrderFieldMark && a.Mark != b.Mark {
+			return markRank[a.Mark] < markRank[b.Mark]
+		}
+		return a.SkillID < b.SkillID
+	}
+	sort.SliceStable(studentSkills, func(i, j int) bool {
+		if direction == model.SortDirectionDesc {
+			return less(studentSkills[j], studentSkills[i])
+		}
+		return less(studentSkills[i], studentSkills[j])
+	})
+}
+
+// matchesMarks reports whether a mark is kept by the marks of a student skill filter
+func matchesMarks(filter *model.StudentSkillFilter, mark db.Mark) bool {
+	if filter == nil || filter.MarksIn == nil {
+		return true
+	}
+	for _, wanted := range filter.MarksIn {
+		if db.Mark(wanted) == mark {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,281 @@
+package graph
+
+import (
+	"kontrakt-server/graph/model"
+	"kontrakt-server/prisma/db"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// setParams leaves out the params of optional values that were not given
+func setParams(params interface{}) []interface{} {
+	var set []interface{}
+	value := reflect.ValueOf(params)
+	for i := 0; i < value.Len(); i++ {
+		if !value.Index(i).Elem().IsZero() {
+			set = append(set, value.Index(i).Interface())
+		}
+	}
+	return set
+}
+
+func TestDateRange(t *testing.T) {
+	monday := time.Date(2021, 9, 6, 0, 0, 0, 0, time.UTC)
+	friday := time.Date(2021, 9, 10, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		dates    *model.DateRange
+		wantFrom *time.Time
+		wantTo   *time.Time
+		wantErr  bool
+	}{
+		{"no range", nil, nil, nil, false},
+		{"open end", &model.DateRange{From: &monday}, &monday, nil, false},
+		{"open start", &model.DateRange{To: &friday}, nil, &friday, false},
+		{"single day", &model.DateRange{From: &monday, To: &monday}, &monday, &monday, false},
+		{"week", &model.DateRange{From: &monday, To: &friday}, &monday, &friday, false},
+		{"ends before it starts", &model.DateRange{From: &friday, To: &monday}, nil, nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			from, to, err := dateRange(test.dates)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("dateRange() error = %v, want error %v", err, test.wantErr)
+			}
+			if !reflect.DeepEqual(from, test.wantFrom) || !reflect.DeepEqual(to, test.wantTo) {
+				t.Errorf("dateRange() = %v, %v, want %v, %v", from, to, test.wantFrom, test.wantTo)
+			}
+		})
+	}
+}
+
+func TestContractWhere(t *testing.T) {
+	archived := true
+	monday := time.Date(2021, 9, 6, 0, 0, 0, 0, time.UTC)
+	friday := time.Date(2021, 9, 10, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		filter  *model.ContractFilter
+		want    []db.ContractWhereParam
+		wantErr bool
+	}{
+		{"no filter", nil, nil, false},
+		{"empty filter", &model.ContractFilter{}, nil, false},
+		{
+			"name",
+			&model.ContractFilter{NameContains: stringPointer("math")},
+			[]db.ContractWhereParam{db.Contract.Name.Contains("math"), db.Contract.Name.Mode(db.QueryModeInsensitive)},
+			false,
+		},
+		{"archived", &model.ContractFilter{Archived: &archived}, []db.ContractWhereParam{db.Contract.Archived.Equals(true)}, false},
+		{
+			"start and end ranges",
+			&model.ContractFilter{Start: &model.DateRange{From: &monday}, End: &model.DateRange{To: &friday}},
+			[]db.ContractWhereParam{db.Contract.Start.AfterEquals(monday), db.Contract.End.BeforeEquals(friday)},
+			false,
+		},
+		{"groups", &model.ContractFilter{GroupIDs: []int{1, 2}}, []db.ContractWhereParam{db.Contract.Groups.Some(db.Group.ID.In([]int{1, 2}))}, false},
+		{"invalid range", &model.ContractFilter{Start: &model.DateRange{From: &friday, To: &monday}}, nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := contractWhere(test.filter)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("contractWhere() error = %v, want error %v", err, test.wantErr)
+			}
+			if !reflect.DeepEqual(setParams(got), setParams(test.want)) {
+				t.Errorf("contractWhere() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestContractWhereActive(t *testing.T) {
+	for _, active := range []bool{true, false} {
+		params, err := contractWhere(&model.ContractFilter{Active: &active})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := setParams(params); len(got) != 1 {
+			t.Errorf("contractWhere(active: %v) = %+v, want a single condition", active, got)
+		}
+	}
+}
+
+func TestSkillWhere(t *testing.T) {
+	archived := false
+	tests := []struct {
+		name    string
+		filter  *model.SkillFilter
+		want    []db.SkillWhereParam
+		wantErr bool
+	}{
+		{"no filter", nil, nil, false},
+		{
+			"name",
+			&model.SkillFilter{NameContains: stringPointer("fractions")},
+			[]db.SkillWhereParam{db.Skill.Name.Contains("fractions"), db.Skill.Name.Mode(db.QueryModeInsensitive)},
+			false,
+		},
+		{
+			"contract",
+			&model.SkillFilter{Contract: &model.ContractFilter{Archived: &archived}},
+			[]db.SkillWhereParam{db.Skill.Contract.Where(
+				db.Contract.Archived.Equals(false),
+				// Dates that are not given leave empty params
+				db.Contract.Start.AfterEqualsIfPresent(nil),
+				db.Contract.Start.BeforeEqualsIfPresent(nil),
+				db.Contract.End.AfterEqualsIfPresent(nil),
+				db.Contract.End.BeforeEqualsIfPresent(nil),
+			)},
+			false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := skillWhere(test.filter)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("skillWhere() error = %v, want error %v", err, test.wantErr)
+			}
+			if !reflect.DeepEqual(setParams(got), setParams(test.want)) {
+				t.Errorf("skillWhere() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestStudentWhere(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter *model.StudentFilter
+		want   []db.StudentWhereParam
+	}{
+		{"no filter", nil, nil},
+		{
+			"name matches first name, last name or username",
+			&model.StudentFilter{NameContains: stringPointer("du")},
+			[]db.StudentWhereParam{db.Student.Or(
+				db.Student.And(db.Student.FirstName.Contains("du"), db.Student.FirstName.Mode(db.QueryModeInsensitive)),
+				db.Student.And(db.Student.LastName.Contains("du"), db.Student.LastName.Mode(db.QueryModeInsensitive)),
+				db.Student.OwnerID.Contains("du"),
+			)},
+		},
+		{"groups", &model.StudentFilter{GroupIDs: []int{4}}, []db.StudentWhereParam{db.Student.Groups.Some(db.Group.ID.In([]int{4}))}},
+		{
+			"contract",
+			&model.StudentFilter{ContractID: intPointer(9)},
+			[]db.StudentWhereParam{db.Student.Groups.Some(db.Group.Contracts.Some(db.Contract.ID.Equals(9)))},
+		},
+		{
+			"marks",
+			&model.StudentFilter{HasStudentSkill: &model.StudentSkillFilter{MarksIn: []model.Mark{model.MarkBad, model.MarkVeryBad}}},
+			[]db.StudentWhereParam{db.Student.StudentSkills.Some(db.StudentSkill.Mark.In([]db.Mark{db.MarkBAD, db.MarkVERYBAD}))},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := studentWhere(test.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(setParams(got), setParams(test.want)) {
+				t.Errorf("studentWhere() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestStudentWhereInvalidRange(t *testing.T) {
+	monday := time.Date(2021, 9, 6, 0, 0, 0, 0, time.UTC)
+	friday := time.Date(2021, 9, 10, 0, 0, 0, 0, time.UTC)
+	filter := &model.StudentFilter{HasStudentSkill: &model.StudentSkillFilter{Skill: &model.SkillFilter{Contract: &model.ContractFilter{End: &model.DateRange{From: &friday, To: &monday}}}}}
+	if _, err := studentWhere(filter); err == nil {
+		t.Errorf("studentWhere() should reject a range nested in a filter")
+	}
+}
+
+func TestContractOrder(t *testing.T) {
+	tests := []struct {
+		name    string
+		orderBy *model.ContractOrderBy
+		page    page
+		want    []db.ContractOrderByParam
+	}{
+		{"by id", nil, page{}, []db.ContractOrderByParam{db.Contract.ID.Order(db.SortOrderAsc)}},
+		{"by id backward", nil, page{backward: true}, []db.ContractOrderByParam{db.Contract.ID.Order(db.SortOrderDesc)}},
+		{
+			"by name with id to break ties",
+			&model.ContractOrderBy{Field: model.ContractOrderFieldName, Direction: model.SortDirectionAsc},
+			page{},
+			[]db.ContractOrderByParam{db.Contract.Name.Order(db.SortOrderAsc), db.Contract.ID.Order(db.SortOrderAsc)},
+		},
+		{
+			"by start descending, backward",
+			&model.ContractOrderBy{Field: model.ContractOrderFieldStart, Direction: model.SortDirectionDesc},
+			page{backward: true},
+			[]db.ContractOrderByParam{db.Contract.Start.Order(db.SortOrderAsc), db.Contract.ID.Order(db.SortOrderAsc)},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := contractOrder(test.orderBy, test.page); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("contractOrder() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSortStudentSkills(t *testing.T) {
+	studentSkill := func(skillID int, mark db.Mark) db.StudentSkillModel {
+		return db.StudentSkillModel{InnerStudentSkill: db.InnerStudentSkill{SkillID: skillID, Mark: mark}}
+	}
+	skillIDs := func(studentSkills []db.StudentSkillModel) []int {
+		var ids []int
+		for _, studentSkill := range studentSkills {
+			ids = append(ids, studentSkill.SkillID)
+		}
+		return ids
+	}
+	tests := []struct {
+		name    string
+		orderBy *model.StudentSkillOrderBy
+		want    []int
+	}{
+		{"by skill", nil, []int{1, 2, 3, 4}},
+		{"by skill descending", &model.StudentSkillOrderBy{Field: model.StudentSkillOrderFieldSkillID, Direction: model.SortDirectionDesc}, []int{4, 3, 2, 1}},
+		{"by mark then skill", &model.StudentSkillOrderBy{Field: model.StudentSkillOrderFieldMark, Direction: model.SortDirectionAsc}, []int{2, 4, 3, 1}},
+		{"by mark descending", &model.StudentSkillOrderBy{Field: model.StudentSkillOrderFieldMark, Direction: model.SortDirectionDesc}, []int{1, 3, 4, 2}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			studentSkills := []db.StudentSkillModel{studentSkill(3, db.MarkGOOD), studentSkill(1, db.MarkBAD), studentSkill(4, db.MarkTOFINISH), studentSkill(2, db.MarkTODO)}
+			sortStudentSkills(studentSkills, test.orderBy)
+			if got := skillIDs(studentSkills); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("sortStudentSkills() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMatchesMarks(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter *model.StudentSkillFilter
+		mark   db.Mark
+		want   bool
+	}{
+		{"no filter", nil, db.MarkBAD, true},
+		{"no marks", &model.StudentSkillFilter{}, db.MarkBAD, true},
+		{"listed mark", &model.StudentSkillFilter{MarksIn: []model.Mark{model.MarkBad, model.MarkGood}}, db.MarkGOOD, true},
+		{"other mark", &model.StudentSkillFilter{MarksIn: []model.Mark{model.MarkBad}}, db.MarkGOOD, false},
+		{"empty list", &model.StudentSkillFilter{MarksIn: []model.Mark{}}, db.MarkGOOD, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := matchesMarks(test.filter, test.mark); got != test.want {
+				t.Errorf("matchesMarks(%v) = %v, want %v", test.mark, got, test.want)
+			}
+		})
+	}
+}
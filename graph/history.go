@@ -0,0 +1,171 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"kontrakt-server/graph/auth"
+	"kontrakt-server/graph/model"
+	"kontrakt-server/prisma/db"
+
+	"github.com/prisma/prisma-client-go/runtime/transaction"
+)
+
+const (
+	maxBulkMarks = 1000
+	// Bounds of the number of events returned by recentStudentSkillEvents
+	defaultRecentEvents = 50
+	maxRecentEvents     = 200
+)
+
+// recentEventsLimit keeps the requested number of recent events within bounds
+func recentEventsLimit(limit *int) int {
+	if limit == nil {
+		return defaultRecentEvents
+	}
+	if *limit < 1 {
+		return 1
+	}
+	if *limit > maxRecentEvents {
+		return maxRecentEvents
+	}
+	return *limit
+}
+
+// markChangeEvent returns the transaction appending a mark change to the history of a student skill.
+// It returns false when there is nothing to record, i.e. the mark did not change and no comment was given.
+func (r *Resolver) markChangeEvent(ctx context.Context, previous *db.StudentSkillModel, studentUsername string, skillID int, mark db.Mark, comment *string) (transaction.Param, bool) {
+	var previousMark *db.Mark
+	if previous != nil {
+		previousMark = &previous.Mark
+	}
+	if previousMark != nil && *previousMark == mark && comment == nil {
+		return nil, false
+	}
+	return r.Prisma.StudentSkillEvent.CreateOne(
+		db.StudentSkillEvent.StudentSkill.Link(db.StudentSkill.StudentIDSkillID(db.StudentSkill.StudentID.Equals(studentUsername), db.StudentSkill.SkillID.Equals(skillID))),
+		db.StudentSkillEvent.NewMark.Set(mark),
+		db.StudentSkillEvent.Author.Link(db.User.Username.Equals(auth.ForContext(ctx).Username)),
+		db.StudentSkillEvent.PreviousMark.SetOptional(previousMark),
+		db.StudentSkillEvent.Comment.SetOptional(comment),
+	).Tx(), true
+}
+
+// studentSkillKey identifies the mark of a student on a skill
+type studentSkillKey struct {
+	studentUsername string
+	skillID         int
+}
+
+// upsertStudentSkills checks every mark and, when they are all valid, saves them along with their history at once.
+// A student can only be marked on the skills of the contracts of their groups.
+func (r *Resolver) upsertStudentSkills(ctx context.Context, inputs []model.StudentSkillInput) ([]model.StudentSkillResult, error) {
+	if len(inputs) > maxBulkMarks {
+		return nil, fmt.Errorf("at most %d marks can be saved at once", maxBulkMarks)
+	}
+	if len(inputs) == 0 {
+		return []model.StudentSkillResult{}, nil
+	}
+	var skillIDs []int
+	var usernames []string
+	for _, input := range inputs {
+		skillIDs = append(skillIDs, input.SkillID)
+		usernames = append(usernames, input.StudentUsername)
+	}
+	skills, err := r.Prisma.Skill.FindMany(db.Skill.ID.In(skillIDs)).With(db.Skill.Contract.Fetch().With(
+		db.Contract.MarkScale.Fetch().With(db.MarkScale.Levels.Fetch()),
+		db.Contract.Groups.Fetch().With(db.Group.Students.Fetch(db.Student.OwnerID.In(usernames))),
+	)).Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	skillByID := make(map[int]db.SkillModel)
+	for _, skill := range skills {
+		skillByID[skill.ID] = skill
+	}
+	studentSkills, err := r.Prisma.StudentSkill.FindMany(db.StudentSkill.SkillID.In(skillIDs), db.StudentSkill.StudentID.In(usernames)).Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	previous := make(map[studentSkillKey]*db.StudentSkillModel)
+	for i, studentSkill := range studentSkills {
+		previous[studentSkillKey{studentSkill.StudentID, studentSkill.SkillID}] = &studentSkills[i]
+	}
+
+	results, valid := checkBulkMarks(skillByID, inputs)
+	if !valid {
+		return results, nil
+	}
+
+	var transactions []transaction.Param
+	// The saved marks are read back once the transaction is committed
+	savedMarks := make([]func() *db.StudentSkillModel, 0, len(inputs))
+	for _, input := range inputs {
+		mark := db.Mark(input.Mark)
+		upsert := r.Prisma.StudentSkill.UpsertOne(db.StudentSkill.StudentIDSkillID(db.StudentSkill.StudentID.Equals(input.StudentUsername), db.StudentSkill.SkillID.Equals(input.SkillID))).Update(db.StudentSkill.Mark.Set(mark)).Create(
+			db.StudentSkill.Mark.Set(mark),
+			db.StudentSkill.Skill.Link(db.Skill.ID.Equals(input.SkillID)),
+			db.StudentSkill.Student.Link(db.Student.OwnerID.Equals(input.StudentUsername)),
+		).Tx()
+		savedMarks = append(savedMarks, upsert.Result)
+		transactions = append(transactions, upsert)
+		if event, ok := r.markChangeEvent(ctx, previous[studentSkillKey{input.StudentUsername, input.SkillID}], input.StudentUsername, input.SkillID, mark, input.Comment); ok {
+			transactions = append(transactions, event)
+		}
+	}
+	if err := r.Prisma.Prisma.Transaction(transactions...).Exec(ctx); err != nil {
+		return nil, err
+	}
+	changes := make([]studentSkillChange, 0, len(inputs))
+	for i, savedMark := range savedMarks {
+		results[i].StudentSkill = savedMark()
+		changes = append(changes, studentSkillChange{StudentUsername: inputs[i].StudentUsername, SkillID: inputs[i].SkillID})
+	}
+	r.publishStudentSkillChanges(ctx, changes)
+	return results, nil
+}
+
+// checkBulkMarks gives the result of every mark of a bulk save, with an error for the invalid ones.
+// The marks are only valid when none of them has an error.
+func checkBulkMarks(skills map[int]db.SkillModel, inputs []model.StudentSkillInput) ([]model.StudentSkillResult, bool) {
+	results := make([]model.StudentSkillResult, 0, len(inputs))
+	valid := true
+	seen := make(map[studentSkillKey]bool)
+	for _, input := range inputs {
+		result := model.StudentSkillResult{StudentUsername: input.StudentUsername, SkillID: input.SkillID}
+		if err := checkBulkMark(skills, seen, input); err != nil {
+			message := err.Error()
+			result.Error = &message
+			valid = false
+		}
+		seen[studentSkillKey{input.StudentUsername, input.SkillID}] = true
+		results = append(results, result)
+	}
+	return results, valid
+}
+
+// checkBulkMark makes sure a mark of a bulk save targets a skill of a contract of the student and is part of its scale
+func checkBulkMark(skills map[int]db.SkillModel, seen map[studentSkillKey]bool, input model.StudentSkillInput) error {
+	if seen[studentSkillKey{input.StudentUsername, input.SkillID}] {
+		return fmt.Errorf("this mark is given more than once")
+	}
+	skill, ok := skills[input.SkillID]
+	if !ok {
+		return fmt.Errorf("the skill %d does not exist", input.SkillID)
+	}
+	contract := skill.Contract()
+	inGroups := false
+	for _, group := range contract.Groups() {
+		for _, student := range group.Students() {
+			if student.OwnerID == input.StudentUsername {
+				inGroups = true
+			}
+		}
+	}
+	if !inGroups {
+		return fmt.Errorf("%s is not in a group of the contract %s", input.StudentUsername, contract.Name)
+	}
+	if scale, ok := contract.MarkScale(); ok {
+		return markInScale(scale, db.Mark(input.Mark))
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package graph
+
+import (
+	"kontrakt-server/graph/model"
+	"kontrakt-server/prisma/db"
+	"reflect"
+	"testing"
+)
+
+// bulkMarkSkills has a skill 1 in a contract without scale for the group of mdupont and lmartin,
+// and a skill 2 in a contract whose scale only has good and bad marks for the group of pdurand
+func bulkMarkSkills() map[int]db.SkillModel {
+	student := func(username string) db.StudentModel {
+		return db.StudentModel{InnerStudent: db.InnerStudent{OwnerID: username}}
+	}
+	group := func(students ...db.StudentModel) db.GroupModel {
+		return db.GroupModel{RelationsGroup: db.RelationsGroup{Students: students}}
+	}
+	level := func(mark db.Mark) db.MarkScaleLevelModel {
+		return db.MarkScaleLevelModel{InnerMarkScaleLevel: db.InnerMarkScaleLevel{Mark: mark}}
+	}
+	fractions := db.ContractModel{
+		InnerContract:     db.InnerContract{ID: 1, Name: "Fractions"},
+		RelationsContract: db.RelationsContract{Groups: []db.GroupModel{group(student("mdupont")), group(student("lmartin"))}},
+	}
+	reading := db.ContractModel{
+		InnerContract: db.InnerContract{ID: 2, Name: "Reading"},
+		RelationsContract: db.RelationsContract{
+			Groups: []db.GroupModel{group(student("pdurand"))},
+			MarkScale: &db.MarkScaleModel{
+				InnerMarkScale:     db.InnerMarkScale{Name: "Simple"},
+				RelationsMarkScale: db.RelationsMarkScale{Levels: []db.MarkScaleLevelModel{level(db.MarkGOOD), level(db.MarkBAD)}},
+			},
+		},
+	}
+	return map[int]db.SkillModel{
+		1: {InnerSkill: db.InnerSkill{ID: 1}, RelationsSkill: db.RelationsSkill{Contract: &fractions}},
+		2: {InnerSkill: db.InnerSkill{ID: 2}, RelationsSkill: db.RelationsSkill{Contract: &reading}},
+	}
+}
+
+func TestCheckBulkMarks(t *testing.T) {
+	mark := func(username string, skillID int, mark model.Mark) model.StudentSkillInput {
+		return model.StudentSkillInput{StudentUsername: username, SkillID: skillID, Mark: mark}
+	}
+	tests := []struct {
+		name       string
+		inputs     []model.StudentSkillInput
+		wantErrors []string
+		wantValid  bool
+	}{
+		{"no marks", nil, nil, true},
+		{
+			"valid marks",
+			[]model.StudentSkillInput{mark("mdupont", 1, model.MarkVeryGood), mark("lmartin", 1, model.MarkToFinish), mark("pdurand", 2, model.MarkGood)},
+			[]string{"", "", ""},
+			true,
+		},
+		{"to do is part of every scale", []model.StudentSkillInput{mark("pdurand", 2, model.MarkTodo)}, []string{""}, true},
+		{
+			"one invalid mark rejects them all",
+			[]model.StudentSkillInput{mark("mdupont", 1, model.MarkGood), mark("mdupont", 3, model.MarkGood), mark("lmartin", 1, model.MarkBad)},
+			[]string{"", "the skill 3 does not exist", ""},
+			false,
+		},
+		{
+			"student outside the groups of the contract",
+			[]model.StudentSkillInput{mark("pdurand", 1, model.MarkGood), mark("mdupont", 2, model.MarkGood)},
+			[]string{"pdurand is not in a group of the contract Fractions", "mdupont is not in a group of the contract Reading"},
+			false,
+		},
+		{
+			"mark outside the scale of the contract",
+			[]model.StudentSkillInput{mark("pdurand", 2, model.MarkVeryGood)},
+			[]string{"mark VERY_GOOD is not part of the Simple mark scale"},
+			false,
+		},
+		{
+			"same mark given twice",
+			[]model.StudentSkillInput{mark("mdupont", 1, model.MarkGood), mark("lmartin", 1, model.MarkGood), mark("mdupont", 1, model.MarkBad)},
+			[]string{"", "", "this mark is given more than once"},
+			false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			results, valid := checkBulkMarks(bulkMarkSkills(), test.inputs)
+			if valid != test.wantValid {
+				t.Errorf("checkBulkMarks() valid = %v, want %v", valid, test.wantValid)
+			}
+			if len(results) != len(test.inputs) {
+				t.Fatalf("checkBulkMarks() gave %d results for %d marks", len(results), len(test.inputs))
+			}
+			var errors []string
+			for i, result := range results {
+				if result.StudentUsername != test.inputs[i].StudentUsername || result.SkillID != test.inputs[i].SkillID {
+					t.Errorf("result %d is for %s on skill %d, want the mark in the same position", i, result.StudentUsername, result.SkillID)
+				}
+				if result.StudentSkill != nil {
+					t.Errorf("result %d has a saved mark before anything is saved", i)
+				}
+				message := ""
+				if result.Error != nil {
+					message = *result.Error
+				}
+				errors = append(errors, message)
+			}
+			if !reflect.DeepEqual(errors, test.wantErrors) {
+				t.Errorf("checkBulkMarks() errors = %q, want %q", errors, test.wantErrors)
+			}
+		})
+	}
+}
@@ -0,0 +1,312 @@
+package graph
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"kontrakt-server/graph/model"
+	"kontrakt-server/prisma/db"
+	"kontrakt-server/utils"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/prisma/prisma-client-go/runtime/transaction"
+	"github.com/xuri/excelize/v2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	maxImportSize = 1 << 20
+	// Every student needs a bcrypt hash, which takes tens of milliseconds, so large rosters should be split
+	maxImportRows = 300
+)
+
+// Headers are compared in lower case without spaces, dashes or underscores
+var rosterHeaders = map[string]string{
+	"firstname":   "firstName",
+	"prénom":      "firstName",
+	"prenom":      "firstName",
+	"lastname":    "lastName",
+	"nom":         "lastName",
+	"password":    "password",
+	"motdepasse":  "password",
+	"groups":      "groups",
+	"group":       "groups",
+	"groupes":     "groups",
+	"groupe":      "groups",
+	"groupnames":  "groups",
+	"classe":      "groups",
+	"classes":     "groups",
+	"username":    "username",
+	"login":       "username",
+	"identifiant": "username",
+}
+
+// rosterRow is a student read from an imported roster
+type rosterRow struct {
+	line      int
+	firstName string
+	lastName  string
+	username  string
+	password  string
+	groups    []string
+}
+
+// readRoster returns the cells of an uploaded CSV or XLSX roster, XLSX files are read from their first sheet
+func readRoster(file graphql.Upload) ([][]string, error) {
+	if file.Size > maxImportSize {
+		return nil, fmt.Errorf("a roster cannot be larger than %d MB", maxImportSize>>20)
+	}
+	content, err := ioutil.ReadAll(io.LimitReader(file.File, maxImportSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(content) > maxImportSize {
+		return nil, fmt.Errorf("a roster cannot be larger than %d MB", maxImportSize>>20)
+	}
+	// XLSX files are zip archives
+	if strings.EqualFold(filepath.Ext(file.Filename), ".xlsx") || bytes.HasPrefix(content, []byte("PK\x03\x04")) {
+		f, err := excelize.OpenReader(bytes.NewReader(content))
+		if err != nil {
+			return nil, fmt.Errorf("the roster is not a valid XLSX file")
+		}
+		sheets := f.GetSheetList()
+		if len(sheets) == 0 {
+			return nil, fmt.Errorf("the roster has no sheet")
+		}
+		return f.GetRows(sheets[0])
+	}
+	content = bytes.TrimPrefix(content, []byte("\xef\xbb\xbf"))
+	reader := csv.NewReader(bytes.NewReader(content))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	// Spreadsheet software set to French separates cells with semicolons
+	firstLine := content
+	if end := bytes.IndexByte(content, '\n'); end >= 0 {
+		firstLine = content[:end]
+	}
+	if bytes.Count(firstLine, []byte(";")) > bytes.Count(firstLine, []byte(",")) {
+		reader.Comma = ';'
+	}
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("the roster is not a valid CSV file: %v", err)
+	}
+	return records, nil
+}
+
+// parseRoster reads the students of a roster whose first row names the columns.
+// Groups are separated by commas or semicolons within their cell.
+func parseRoster(records [][]string) ([]rosterRow, error) {
+	if len(records) == 0 {
+		return nil, fmt.Errorf("the roster is empty")
+	}
+	columns := make(map[string]int)
+	for index, header := range records[0] {
+		normalized := strings.ToLower(strings.TrimSpace(header))
+		normalized = strings.NewReplacer(" ", "", "-", "", "_", "").Replace(normalized)
+		if column, ok := rosterHeaders[normalized]; ok {
+			columns[column] = index
+		}
+	}
+	if _, ok := columns["firstName"]; !ok {
+		return nil, fmt.Errorf("the roster needs a first name column")
+	}
+	if _, ok := columns["lastName"]; !ok {
+		return nil, fmt.Errorf("the roster needs a last name column")
+	}
+	if len(records)-1 > maxImportRows {
+		return nil, fmt.Errorf("a roster cannot contain more than %d students", maxImportRows)
+	}
+	cell := func(record []string, column string) string {
+		index, ok := columns[column]
+		if !ok || index >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[index])
+	}
+	var rows []rosterRow
+	for i, record := range records[1:] {
+		row := rosterRow{
+			line:      i + 2,
+			firstName: cell(record, "firstName"),
+			lastName:  cell(record, "lastName"),
+			username:  cell(record, "username"),
+			password:  cell(record, "password"),
+		}
+		for _, group := range strings.FieldsFunc(cell(record, "groups"), func(r rune) bool { return r == ',' || r == ';' }) {
+			if group = strings.TrimSpace(group); len(group) > 0 {
+				row.groups = append(row.groups, group)
+			}
+		}
+		// Blank lines are often left at the end of a sheet
+		if len(row.firstName) == 0 && len(row.lastName) == 0 && len(row.username) == 0 && len(row.password) == 0 && len(row.groups) == 0 {
+			continue
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// importStudents checks every row of a roster and, unless it is a dry run, creates all the students at once.
+// Nothing is created when a row has an error.
+func (r *Resolver) importStudents(ctx context.Context, rows []rosterRow, dryRun bool) (*model.StudentImportResult, error) {
+	groups, err := r.Prisma.Group.FindMany().Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	groupIDs := make(map[string]int)
+	for _, group := range groups {
+		groupIDs[strings.ToLower(group.Name)] = group.ID
+	}
+	// Usernames are generated once the ones chosen in the roster are known
+	var prefixes []string
+	for _, row := range rows {
+		if len(row.username) > 0 {
+			prefixes = append(prefixes, strings.ToLower(row.username))
+		} else if base := utils.UsernameBase(row.firstName, row.lastName); len(base) > 0 {
+			prefixes = append(prefixes, base)
+		}
+	}
+	taken, err := r.takenUsernames(ctx, prefixes)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &model.StudentImportResult{DryRun: dryRun, Rows: []model.StudentImportRow{}}
+	chosenOn := make(map[string]int)
+	for _, row := range rows {
+		imported := model.StudentImportRow{Line: row.line, FirstName: row.firstName, LastName: row.lastName, GroupNames: row.groups, Errors: []string{}}
+		if imported.GroupNames == nil {
+			imported.GroupNames = []string{}
+		}
+		if len(row.firstName) == 0 {
+			imported.Errors = append(imported.Errors, "the first name is missing")
+		}
+		if len(row.lastName) == 0 {
+			imported.Errors = append(imported.Errors, "the last name is missing")
+		}
+		if len(row.username) > 0 {
+			username, err := validateUsername(row.username)
+			if err != nil {
+				imported.Errors = append(imported.Errors, err.Error())
+			} else if line, ok := chosenOn[username]; ok {
+				imported.Errors = append(imported.Errors, fmt.Sprintf("the username %s is also chosen on line %d", username, line))
+			} else if taken[username] {
+				imported.Errors = append(imported.Errors, usernameTaken(username).Error())
+			} else {
+				chosenOn[username] = row.line
+				imported.Username = &username
+			}
+		}
+		// Students without a password get a temporary one
+		if len(row.password) > 0 {
+			if err := validatePassword(row.password); err != nil {
+				imported.Errors = append(imported.Errors, err.Error())
+			}
+		}
+		for _, group := range row.groups {
+			if _, ok := groupIDs[strings.ToLower(group)]; !ok {
+				imported.Errors = append(imported.Errors, fmt.Sprintf("the group %s does not exist", group))
+			}
+		}
+		result.Rows = append(result.Rows, imported)
+	}
+	for username := range chosenOn {
+		taken[username] = true
+	}
+	valid := true
+	for i, row := range rows {
+		if len(row.username) == 0 && len(row.firstName) > 0 && len(row.lastName) > 0 {
+			if base := utils.UsernameBase(row.firstName, row.lastName); len(base) > 0 {
+				username := nextUsername(base, taken)
+				result.Rows[i].Username = &username
+			} else {
+				result.Rows[i].Errors = append(result.Rows[i].Errors, "a username cannot be made from the name, please choose one")
+			}
+		}
+		if len(result.Rows[i].Errors) > 0 {
+			valid = false
+		}
+	}
+	if dryRun || !valid {
+		return result, nil
+	}
+
+	passwords := make([]string, len(rows))
+	for i, row := range rows {
+		passwords[i] = row.password
+		// Students without a password get a temporary one they must change
+		if len(row.password) == 0 {
+			if passwords[i], err = utils.RandomToken(4); err != nil {
+				return nil, err
+			}
+			result.Rows[i].GeneratedPassword = &passwords[i]
+		}
+	}
+	hashedPasswords, err := hashPasswords(passwords)
+	if err != nil {
+		return nil, err
+	}
+
+	var transactions []transaction.Param
+	for i, row := range rows {
+		mustChangePassword := len(row.password) == 0
+		username := *result.Rows[i].Username
+		var groups []db.GroupWhereParam
+		for _, group := range row.groups {
+			groups = append(groups, db.Group.ID.Equals(groupIDs[strings.ToLower(group)]))
+		}
+		var param []db.StudentSetParam
+		if len(groups) > 0 {
+			param = append(param, db.Student.Groups.Link(groups...))
+		}
+		transactions = append(transactions,
+			r.Prisma.User.CreateOne(db.User.Username.Set(username), db.User.Password.Set(hashedPasswords[i]), db.User.Role.Set(db.RoleSTUDENT), db.User.MustChangePassword.Set(mustChangePassword)).Tx(),
+			r.Prisma.Student.CreateOne(db.Student.Owner.Link(db.User.Username.Equals(username)), db.Student.FirstName.Set(strings.Title(row.firstName)), db.Student.LastName.Set(strings.Title(row.lastName)), param...).Tx(),
+		)
+	}
+	if err := r.Prisma.Prisma.Transaction(transactions...).Exec(ctx); err != nil {
+		if isUniqueViolation(err) {
+			return nil, fmt.Errorf("a username of the roster was taken in the meantime, please import it again")
+		}
+		return nil, err
+	}
+	result.Imported = len(rows)
+	return result, nil
+}
+
+// hashPasswords hashes passwords on every available CPU, bcrypt being far slower than the rest of an import
+func hashPasswords(passwords []string) ([]string, error) {
+	hashed := make([]string, len(passwords))
+	errs := make([]error, len(passwords))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for worker := 0; worker < runtime.NumCPU(); worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				hash, err := bcrypt.GenerateFromPassword([]byte(passwords[i]), bcrypt.DefaultCost)
+				hashed[i], errs[i] = string(hash), err
+			}
+		}()
+	}
+	for i := range passwords {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return hashed, nil
+}
@@ -0,0 +1,62 @@
+package graph
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRoster(t *testing.T) {
+	tests := []struct {
+		name    string
+		records [][]string
+		want    []rosterRow
+		wantErr bool
+	}{
+		{"empty roster", nil, nil, true},
+		{"missing first name column", [][]string{{"Nom"}, {"Dupont"}}, nil, true},
+		{"missing last name column", [][]string{{"Prénom"}, {"Marie"}}, nil, true},
+		{"headers only", [][]string{{"First name", "Last name"}}, nil, false},
+		{
+			"english headers",
+			[][]string{{"First name", "Last name", "Username", "Password", "Groups"}, {" Marie ", "Dupont", "mdupont", "secret123", "6A, 6B"}},
+			[]rosterRow{{line: 2, firstName: "Marie", lastName: "Dupont", username: "mdupont", password: "secret123", groups: []string{"6A", "6B"}}},
+			false,
+		},
+		{
+			"french headers in any order",
+			[][]string{{"Classe", "Nom", "Prénom", "Mot de passe"}, {"6A;6B", "Martin", "Léa", ""}},
+			[]rosterRow{{line: 2, firstName: "Léa", lastName: "Martin", groups: []string{"6A", "6B"}}},
+			false,
+		},
+		{
+			"headers ignore case, dashes and underscores",
+			[][]string{{"FIRST_NAME", "last-name", "Identifiant"}, {"Paul", "Durand", "pdurand"}},
+			[]rosterRow{{line: 2, firstName: "Paul", lastName: "Durand", username: "pdurand"}},
+			false,
+		},
+		{
+			"unknown columns are ignored",
+			[][]string{{"Prénom", "Nom", "Notes"}, {"Léa", "Martin", "absent"}},
+			[]rosterRow{{line: 2, firstName: "Léa", lastName: "Martin"}},
+			false,
+		},
+		{
+			"short rows and blank lines",
+			[][]string{{"Prénom", "Nom", "Groupe"}, {"Léa"}, {"", "", ""}, {}, {"Paul", "Durand", " , "}},
+			[]rosterRow{{line: 2, firstName: "Léa"}, {line: 5, firstName: "Paul", lastName: "Durand"}},
+			false,
+		},
+		{"too many rows", append([][]string{{"Prénom", "Nom"}}, make([][]string, maxImportRows+1)...), nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseRoster(test.records)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("parseRoster() error = %v, want error %v", err, test.wantErr)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("parseRoster() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
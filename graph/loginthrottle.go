@@ -0,0 +1,115 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"kontrakt-server/prisma/db"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// throttlePolicy describes how many failed logins are tolerated for a key
+type throttlePolicy struct {
+	// failures allowed before any backoff is applied
+	freeAttempts int
+	// failures after which the key is locked out
+	lockoutThreshold int
+}
+
+var (
+	// many students share the school's IP address, so it is allowed more failures than a single account
+	usernameThrottle = throttlePolicy{freeAttempts: 3, lockoutThreshold: 10}
+	ipThrottle       = throttlePolicy{freeAttempts: 20, lockoutThreshold: 100}
+)
+
+const (
+	loginLockoutDuration = 15 * time.Minute
+	// time.Second shifted further than this exceeds any lockout, and overflows past 33
+	maxBackoffShift = 16
+)
+
+var errInvalidCredentials = fmt.Errorf("invalid credentials")
+var errTooManyAttempts = fmt.Errorf("too many failed login attempts, please retry later")
+
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("kontrakt"), bcrypt.DefaultCost)
+
+func usernameThrottleKey(username string) string {
+	return "user:" + username
+}
+
+func ipThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+// backoff returns how long a key is blocked after the given number of failures
+func (p throttlePolicy) backoff(failures int) time.Duration {
+	if failures >= p.lockoutThreshold {
+		return loginLockoutDuration
+	}
+	if failures < p.freeAttempts {
+		return 0
+	}
+	// The backoff doubles with each failure but never exceeds a lockout
+	shift := failures - p.freeAttempts
+	if shift >= maxBackoffShift {
+		return loginLockoutDuration
+	}
+	if backoff := time.Second << shift; backoff < loginLockoutDuration {
+		return backoff
+	}
+	return loginLockoutDuration
+}
+
+// loginThrottleNow is the current time in the time zone the client stores dates in
+const loginThrottleNow = `(CURRENT_TIMESTAMP AT TIME ZONE 'UTC')`
+
+// backoffSQL returns an SQL expression of the seconds a key is blocked after the failures counted by the given expression.
+// The durations come from backoff, so the database applies the same policy within the statement recording the failure.
+func (p throttlePolicy) backoffSQL(failures string) string {
+	var expression strings.Builder
+	fmt.Fprintf(&expression, "CASE WHEN %s >= %d THEN %d", failures, p.lockoutThreshold, int(loginLockoutDuration/time.Second))
+	for count := p.freeAttempts; count < p.lockoutThreshold; count++ {
+		fmt.Fprintf(&expression, " WHEN %s = %d THEN %d", failures, count, int(p.backoff(count)/time.Second))
+	}
+	expression.WriteString(" ELSE 0 END")
+	return expression.String()
+}
+
+// registerLoginAttempt counts an attempt as a failure before the password is checked and blocks the key according to the policy,
+// or returns errTooManyAttempts when the key is already blocked.
+// Counting and blocking happen in a single statement so attempts sent in parallel cannot get past the policy.
+// Failures are forgotten once the key has been quiet for a lockout period.
+func (r *Resolver) registerLoginAttempt(ctx context.Context, key string, policy throttlePolicy) error {
+	failures := fmt.Sprintf(`CASE WHEN t."lastFailure" > %s - INTERVAL '%d seconds' THEN t."failures" + 1 ELSE 1 END`, loginThrottleNow, int(loginLockoutDuration/time.Second))
+	query := fmt.Sprintf(`INSERT INTO "LoginThrottle" AS t ("key", "failures", "lastFailure", "blockedUntil") VALUES ($1, 1, %[1]s, %[1]s + (%[2]s) * INTERVAL '1 second')
+ON CONFLICT ("key") DO UPDATE SET "failures" = %[3]s, "lastFailure" = %[1]s, "blockedUntil" = %[1]s + (%[4]s) * INTERVAL '1 second'
+WHERE t."blockedUntil" IS NULL OR t."blockedUntil" <= %[1]s
+RETURNING "failures"`, loginThrottleNow, policy.backoffSQL("1"), failures, policy.backoffSQL(failures))
+	var recorded []struct {
+		Failures int `json:"failures"`
+	}
+	if err := r.Prisma.Prisma.QueryRaw(query, key).Exec(ctx, &recorded); err != nil {
+		return err
+	}
+	// Nothing is updated while the key is blocked
+	if len(recorded) == 0 {
+		return errTooManyAttempts
+	}
+	return nil
+}
+
+// forgiveLoginAttempt takes back the failure counted for a successful attempt
+func (r *Resolver) forgiveLoginAttempt(ctx context.Context, key string, policy throttlePolicy) error {
+	failures := `GREATEST(t."failures" - 1, 0)`
+	query := fmt.Sprintf(`UPDATE "LoginThrottle" AS t SET "failures" = %[1]s, "blockedUntil" = %[2]s + (%[3]s) * INTERVAL '1 second' WHERE t."key" = $1`, failures, loginThrottleNow, policy.backoffSQL(failures))
+	_, err := r.Prisma.Prisma.ExecuteRaw(query, key).Exec(ctx)
+	return err
+}
+
+// clearLoginThrottle forgets the failures recorded for a key
+func (r *Resolver) clearLoginThrottle(ctx context.Context, key string) error {
+	_, err := r.Prisma.LoginThrottle.FindMany(db.LoginThrottle.Key.Equals(key)).Delete().Exec(ctx)
+	return err
+}
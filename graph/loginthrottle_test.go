@@ -0,0 +1,77 @@
+package graph
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestThrottlePolicyBackoff(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   throttlePolicy
+		failures int
+		want     time.Duration
+	}{
+		{"first failure is free", usernameThrottle, 1, 0},
+		{"last free attempt", usernameThrottle, 2, 0},
+		{"backoff starts", usernameThrottle, 3, time.Second},
+		{"backoff doubles", usernameThrottle, 5, 4 * time.Second},
+		{"lockout threshold", usernameThrottle, 10, loginLockoutDuration},
+		{"past lockout threshold", usernameThrottle, 50, loginLockoutDuration},
+		{"ip backoff starts", ipThrottle, 20, time.Second},
+		{"ip backoff is capped", ipThrottle, 40, loginLockoutDuration},
+		{"shift would reach zero", ipThrottle, 54, loginLockoutDuration},
+		{"shift would overflow", ipThrottle, 75, loginLockoutDuration},
+		{"just below ip lockout", ipThrottle, 99, loginLockoutDuration},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.policy.backoff(test.failures); got != test.want {
+				t.Errorf("backoff(%d) = %v, want %v", test.failures, got, test.want)
+			}
+		})
+	}
+}
+
+func TestThrottlePolicyBackoffNeverExceedsLockout(t *testing.T) {
+	for _, policy := range []throttlePolicy{usernameThrottle, ipThrottle} {
+		previous := time.Duration(0)
+		for failures := 0; failures <= policy.lockoutThreshold+10; failures++ {
+			backoff := policy.backoff(failures)
+			if backoff < 0 || backoff > loginLockoutDuration {
+				t.Fatalf("backoff(%d) = %v is out of range", failures, backoff)
+			}
+			if backoff < previous {
+				t.Fatalf("backoff(%d) = %v is shorter than after one less failure", failures, backoff)
+			}
+			previous = backoff
+		}
+	}
+}
+
+func TestThrottlePolicyBackoffSQL(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy throttlePolicy
+		want   []string
+	}{
+		{"lockout", usernameThrottle, []string{"CASE WHEN f >= 10 THEN 900"}},
+		{"backoff starts after the free attempts", usernameThrottle, []string{" WHEN f = 3 THEN 1 ", " WHEN f = 5 THEN 4 ", " WHEN f = 9 THEN 64 "}},
+		{"free attempts are not blocked", usernameThrottle, []string{" ELSE 0 END"}},
+		{"ip backoff is capped", ipThrottle, []string{" WHEN f = 20 THEN 1 ", " WHEN f = 99 THEN 900 ", "CASE WHEN f >= 100 THEN 900"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := test.policy.backoffSQL("f")
+			for _, want := range test.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("backoffSQL() = %s, want it to contain %q", got, want)
+				}
+			}
+			if strings.Contains(got, " WHEN f = 2 ") {
+				t.Errorf("backoffSQL() = %s, want no backoff for free attempts", got)
+			}
+		})
+	}
+}
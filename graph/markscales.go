@@ -0,0 +1,96 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"kontrakt-server/graph/model"
+	"kontrakt-server/prisma/db"
+	"regexp"
+
+	"github.com/prisma/prisma-client-go/runtime/transaction"
+)
+
+var hexColorRegexp = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// validateMarkScaleLevels makes sure a scale has levels, each mark at most once and valid colors
+func validateMarkScaleLevels(levels []model.MarkScaleLevelInput) error {
+	if len(levels) == 0 {
+		return fmt.Errorf("a mark scale needs at least one level")
+	}
+	seen := make(map[model.Mark]bool)
+	for _, level := range levels {
+		if !level.Mark.IsValid() {
+			return fmt.Errorf("invalid mark %s", level.Mark)
+		}
+		if seen[level.Mark] {
+			return fmt.Errorf("mark %s is used by more than one level", level.Mark)
+		}
+		seen[level.Mark] = true
+		if !hexColorRegexp.MatchString(level.HexColor) {
+			return fmt.Errorf("invalid color %s for level %s", level.HexColor, level.Label)
+		}
+	}
+	return nil
+}
+
+// createMarkScaleLevels returns the transactions creating the levels of a scale, ordered as given.
+// The scale can be created in the same transaction as it is found by a unique field.
+func (r *Resolver) createMarkScaleLevels(scale db.MarkScaleWhereParam, levels []model.MarkScaleLevelInput) []transaction.Param {
+	var transactions []transaction.Param
+	for position, level := range levels {
+		transactions = append(transactions, r.Prisma.MarkScaleLevel.CreateOne(
+			db.MarkScaleLevel.Scale.Link(scale),
+			db.MarkScaleLevel.Mark.Set(db.Mark(level.Mark)),
+			db.MarkScaleLevel.Position.Set(position),
+			db.MarkScaleLevel.Label.Set(level.Label),
+			db.MarkScaleLevel.HexColor.Set(level.HexColor),
+			db.MarkScaleLevel.Weight.Set(level.Weight),
+			db.MarkScaleLevel.IsAcquired.Set(level.IsAcquired),
+		).Tx())
+	}
+	return transactions
+}
+
+// checkMarkInScale makes sure the mark is part of the scale of the skill's contract, if it has one.
+// TODO is always accepted as it means the skill has not been marked yet.
+func (r *Resolver) checkMarkInScale(ctx context.Context, skillID int, mark db.Mark) error {
+	if mark == db.MarkTODO {
+		return nil
+	}
+	skill, err := r.Prisma.Skill.FindUnique(db.Skill.ID.Equals(skillID)).With(db.Skill.Contract.Fetch().With(db.Contract.MarkScale.Fetch().With(db.MarkScale.Levels.Fetch()))).Exec(ctx)
+	if err != nil {
+		return err
+	}
+	scale, ok := skill.Contract().MarkScale()
+	if !ok {
+		return nil
+	}
+	return markInScale(scale, mark)
+}
+
+// markInScale makes sure the mark is part of a scale whose levels have been fetched, TODO is always accepted
+func markInScale(scale *db.MarkScaleModel, mark db.Mark) error {
+	if mark == db.MarkTODO {
+		return nil
+	}
+	for _, level := range scale.Levels() {
+		if level.Mark == mark {
+			return nil
+		}
+	}
+	return fmt.Errorf("mark %s is not part of the %s mark scale", mark, scale.Name)
+}
+
+// isAcquired reports whether a mark means the skill is acquired for the given scale levels.
+// Without a scale, only the good marks are acquired.
+func isAcquired(levels []db.MarkScaleLevelModel, mark db.Mark) bool {
+	if len(levels) == 0 {
+		return mark == db.MarkGOOD || mark == db.MarkVERYGOOD
+	}
+	for _, level := range levels {
+		if level.Mark == mark {
+			return level.IsAcquired
+		}
+	}
+	return false
+}
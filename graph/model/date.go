@@ -0,0 +1,31 @@
+package model
+
+import (
+	"fmt"
+	"github.com/99designs/gqlgen/graphql"
+	"io"
+	"strconv"
+	"time"
+)
+
+const dateLayout = "2006-01-02"
+
+// MarshalDate writes a day as YYYY-MM-DD, without time or timezone
+func MarshalDate(t time.Time) graphql.Marshaler {
+	return graphql.WriterFunc(func(w io.Writer) {
+		io.WriteString(w, strconv.Quote(t.UTC().Format(dateLayout)))
+	})
+}
+
+// UnmarshalDate reads a day written as YYYY-MM-DD
+func UnmarshalDate(v interface{}) (time.Time, error) {
+	value, ok := v.(string)
+	if !ok {
+		return time.Time{}, fmt.Errorf("a date must be a string")
+	}
+	date, err := time.Parse(dateLayout, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s is not a valid date, expected YYYY-MM-DD", value)
+	}
+	return date, nil
+}
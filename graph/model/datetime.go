@@ -0,0 +1,29 @@
+package model
+
+import (
+	"fmt"
+	"github.com/99designs/gqlgen/graphql"
+	"io"
+	"strconv"
+	"time"
+)
+
+// MarshalDateTime writes an instant as RFC 3339 in UTC
+func MarshalDateTime(t time.Time) graphql.Marshaler {
+	return graphql.WriterFunc(func(w io.Writer) {
+		io.WriteString(w, strconv.Quote(t.UTC().Format(time.RFC3339)))
+	})
+}
+
+// UnmarshalDateTime reads an instant written as RFC 3339
+func UnmarshalDateTime(v interface{}) (time.Time, error) {
+	value, ok := v.(string)
+	if !ok {
+		return time.Time{}, fmt.Errorf("a date time must be a string")
+	}
+	dateTime, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s is not a valid date time, expected RFC 3339", value)
+	}
+	return dateTime, nil
+}
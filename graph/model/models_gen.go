@@ -7,22 +7,208 @@ import (
 	"io"
 	"kontrakt-server/prisma/db"
 	"strconv"
+	"time"
 )
 
 type AuthPayload struct {
-	Token string `json:"token"`
-	User  *User  `json:"user"`
+	Token              string `json:"token"`
+	RefreshToken       string `json:"refreshToken"`
+	MustChangePassword bool   `json:"mustChangePassword"`
+	User               *User  `json:"user"`
+}
+
+type CompetencyProgress struct {
+	Competency    *db.CompetencyModel `json:"competency"`
+	SkillCount    int                 `json:"skillCount"`
+	AcquiredCount int                 `json:"acquiredCount"`
+	MarkCounts    []MarkCount         `json:"markCounts"`
+}
+
+type ContractConnection struct {
+	Edges    []ContractEdge `json:"edges"`
+	PageInfo *PageInfo      `json:"pageInfo"`
+}
+
+type ContractEdge struct {
+	Cursor string            `json:"cursor"`
+	Node   *db.ContractModel `json:"node"`
+}
+
+type ContractFilter struct {
+	NameContains *string    `json:"nameContains"`
+	Archived     *bool      `json:"archived"`
+	Active       *bool      `json:"active"`
+	Start        *DateRange `json:"start"`
+	End          *DateRange `json:"end"`
+	GroupIDs     []int      `json:"groupIDs"`
+}
+
+type ContractOrderBy struct {
+	Field     ContractOrderField `json:"field"`
+	Direction SortDirection      `json:"direction"`
+}
+
+type ContractSkillInput struct {
+	ID          *int    `json:"id"`
+	Name        string  `json:"name"`
+	Description *string `json:"description"`
+}
+
+type DateRange struct {
+	From *time.Time `json:"from"`
+	To   *time.Time `json:"to"`
 }
 
 type FilterGroup struct {
 	IdsIn []int `json:"idsIn"`
 }
 
+type GroupConnection struct {
+	Edges    []GroupEdge `json:"edges"`
+	PageInfo *PageInfo   `json:"pageInfo"`
+}
+
+type GroupEdge struct {
+	Cursor string         `json:"cursor"`
+	Node   *db.GroupModel `json:"node"`
+}
+
+type MarkCount struct {
+	Mark  Mark `json:"mark"`
+	Count int  `json:"count"`
+}
+
+type MarkScaleLevelInput struct {
+	// The mark stored for students given this level, each mark can only be used by one level of a scale
+	Mark       Mark    `json:"mark"`
+	Label      string  `json:"label"`
+	HexColor   string  `json:"hexColor"`
+	Weight     float64 `json:"weight"`
+	IsAcquired bool    `json:"isAcquired"`
+}
+
+type PageInfo struct {
+	HasNextPage     bool    `json:"hasNextPage"`
+	HasPreviousPage bool    `json:"hasPreviousPage"`
+	StartCursor     *string `json:"startCursor"`
+	EndCursor       *string `json:"endCursor"`
+}
+
+type RolloverResult struct {
+	ArchivedContracts int `json:"archivedContracts"`
+	ClearedGroups     int `json:"clearedGroups"`
+}
+
+type SelfAssessmentDivergence struct {
+	Student        *db.StudentModel        `json:"student"`
+	Skill          *db.SkillModel          `json:"skill"`
+	TeacherMark    Mark                    `json:"teacherMark"`
+	SelfAssessment *db.SelfAssessmentModel `json:"selfAssessment"`
+}
+
+type SkillConnection struct {
+	Edges    []SkillEdge `json:"edges"`
+	PageInfo *PageInfo   `json:"pageInfo"`
+}
+
+type SkillEdge struct {
+	Cursor string         `json:"cursor"`
+	Node   *db.SkillModel `json:"node"`
+}
+
+type SkillFilter struct {
+	NameContains *string         `json:"nameContains"`
+	Contract     *ContractFilter `json:"contract"`
+}
+
+type SkillOrderBy struct {
+	Field     SkillOrderField `json:"field"`
+	Direction SortDirection   `json:"direction"`
+}
+
+type StudentConnection struct {
+	Edges    []StudentEdge `json:"edges"`
+	PageInfo *PageInfo     `json:"pageInfo"`
+}
+
+type StudentEdge struct {
+	Cursor string           `json:"cursor"`
+	Node   *db.StudentModel `json:"node"`
+}
+
+type StudentFilter struct {
+	NameContains    *string             `json:"nameContains"`
+	GroupIDs        []int               `json:"groupIDs"`
+	ContractID      *int                `json:"contractID"`
+	HasStudentSkill *StudentSkillFilter `json:"hasStudentSkill"`
+}
+
+type StudentImportResult struct {
+	DryRun   bool               `json:"dryRun"`
+	Imported int                `json:"imported"`
+	Rows     []StudentImportRow `json:"rows"`
+}
+
+type StudentImportRow struct {
+	Line              int      `json:"line"`
+	FirstName         string   `json:"firstName"`
+	LastName          string   `json:"lastName"`
+	Username          *string  `json:"username"`
+	GroupNames        []string `json:"groupNames"`
+	GeneratedPassword *string  `json:"generatedPassword"`
+	Errors            []string `json:"errors"`
+}
+
 type StudentInput struct {
 	FirstName string `json:"firstName"`
 	LastName  string `json:"lastName"`
 }
 
+type StudentOrderBy struct {
+	Field     StudentOrderField `json:"field"`
+	Direction SortDirection     `json:"direction"`
+}
+
+type StudentSkillFilter struct {
+	MarksIn []Mark       `json:"marksIn"`
+	Skill   *SkillFilter `json:"skill"`
+}
+
+type StudentSkillInput struct {
+	StudentUsername string  `json:"studentUsername"`
+	SkillID         int     `json:"skillID"`
+	Mark            Mark    `json:"mark"`
+	Comment         *string `json:"comment"`
+}
+
+type StudentSkillOrderBy struct {
+	Field     StudentSkillOrderField `json:"field"`
+	Direction SortDirection          `json:"direction"`
+}
+
+type StudentSkillResult struct {
+	StudentUsername string                `json:"studentUsername"`
+	SkillID         int                   `json:"skillID"`
+	StudentSkill    *db.StudentSkillModel `json:"studentSkill"`
+	Error           *string               `json:"error"`
+}
+
+type TeacherConnection struct {
+	Edges    []TeacherEdge `json:"edges"`
+	PageInfo *PageInfo     `json:"pageInfo"`
+}
+
+type TeacherEdge struct {
+	Cursor string           `json:"cursor"`
+	Node   *db.TeacherModel `json:"node"`
+}
+
+type TemplateSkillInput struct {
+	Name        string  `json:"name"`
+	Description *string `json:"description"`
+	Category    *string `json:"category"`
+}
+
 type User struct {
 	Username string            `json:"username"`
 	Role     Role              `json:"role"`
@@ -31,7 +217,53 @@ type User struct {
 }
 
 type UserInput struct {
-	Password string `json:"password"`
+	Password string  `json:"password"`
+	Username *string `json:"username"`
+}
+
+type ContractOrderField string
+
+const (
+	ContractOrderFieldID    ContractOrderField = "ID"
+	ContractOrderFieldName  ContractOrderField = "NAME"
+	ContractOrderFieldStart ContractOrderField = "START"
+	ContractOrderFieldEnd   ContractOrderField = "END"
+)
+
+var AllContractOrderField = []ContractOrderField{
+	ContractOrderFieldID,
+	ContractOrderFieldName,
+	ContractOrderFieldStart,
+	ContractOrderFieldEnd,
+}
+
+func (e ContractOrderField) IsValid() bool {
+	switch e {
+	case ContractOrderFieldID, ContractOrderFieldName, ContractOrderFieldStart, ContractOrderFieldEnd:
+		return true
+	}
+	return false
+}
+
+func (e ContractOrderField) String() string {
+	return string(e)
+}
+
+func (e *ContractOrderField) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = ContractOrderField(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid ContractOrderField", str)
+	}
+	return nil
+}
+
+func (e ContractOrderField) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
 }
 
 type Mark string
@@ -127,3 +359,171 @@ func (e *Role) UnmarshalGQL(v interface{}) error {
 func (e Role) MarshalGQL(w io.Writer) {
 	fmt.Fprint(w, strconv.Quote(e.String()))
 }
+
+type SkillOrderField string
+
+const (
+	SkillOrderFieldID       SkillOrderField = "ID"
+	SkillOrderFieldName     SkillOrderField = "NAME"
+	SkillOrderFieldPosition SkillOrderField = "POSITION"
+)
+
+var AllSkillOrderField = []SkillOrderField{
+	SkillOrderFieldID,
+	SkillOrderFieldName,
+	SkillOrderFieldPosition,
+}
+
+func (e SkillOrderField) IsValid() bool {
+	switch e {
+	case SkillOrderFieldID, SkillOrderFieldName, SkillOrderFieldPosition:
+		return true
+	}
+	return false
+}
+
+func (e SkillOrderField) String() string {
+	return string(e)
+}
+
+func (e *SkillOrderField) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = SkillOrderField(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid SkillOrderField", str)
+	}
+	return nil
+}
+
+func (e SkillOrderField) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type SortDirection string
+
+const (
+	SortDirectionAsc  SortDirection = "ASC"
+	SortDirectionDesc SortDirection = "DESC"
+)
+
+var AllSortDirection = []SortDirection{
+	SortDirectionAsc,
+	SortDirectionDesc,
+}
+
+func (e SortDirection) IsValid() bool {
+	switch e {
+	case SortDirectionAsc, SortDirectionDesc:
+		return true
+	}
+	return false
+}
+
+func (e SortDirection) String() string {
+	return string(e)
+}
+
+func (e *SortDirection) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = SortDirection(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid SortDirection", str)
+	}
+	return nil
+}
+
+func (e SortDirection) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type StudentOrderField string
+
+const (
+	StudentOrderFieldUsername  StudentOrderField = "USERNAME"
+	StudentOrderFieldFirstName StudentOrderField = "FIRST_NAME"
+	StudentOrderFieldLastName  StudentOrderField = "LAST_NAME"
+)
+
+var AllStudentOrderField = []StudentOrderField{
+	StudentOrderFieldUsername,
+	StudentOrderFieldFirstName,
+	StudentOrderFieldLastName,
+}
+
+func (e StudentOrderField) IsValid() bool {
+	switch e {
+	case StudentOrderFieldUsername, StudentOrderFieldFirstName, StudentOrderFieldLastName:
+		return true
+	}
+	return false
+}
+
+func (e StudentOrderField) String() string {
+	return string(e)
+}
+
+func (e *StudentOrderField) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = StudentOrderField(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid StudentOrderField", str)
+	}
+	return nil
+}
+
+func (e StudentOrderField) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type StudentSkillOrderField string
+
+const (
+	StudentSkillOrderFieldSkillID StudentSkillOrderField = "SKILL_ID"
+	StudentSkillOrderFieldMark    StudentSkillOrderField = "MARK"
+)
+
+var AllStudentSkillOrderField = []StudentSkillOrderField{
+	StudentSkillOrderFieldSkillID,
+	StudentSkillOrderFieldMark,
+}
+
+func (e StudentSkillOrderField) IsValid() bool {
+	switch e {
+	case StudentSkillOrderFieldSkillID, StudentSkillOrderFieldMark:
+		return true
+	}
+	return false
+}
+
+func (e StudentSkillOrderField) String() string {
+	return string(e)
+}
+
+func (e *StudentSkillOrderField) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = StudentSkillOrderField(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid StudentSkillOrderField", str)
+	}
+	return nil
+}
+
+func (e StudentSkillOrderField) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
@@ -0,0 +1,273 @@
+package graph
+
+import (
+	"context"
+	b64 "encoding/base64"
+	"fmt"
+	"kontrakt-server/graph/model"
+	"kontrakt-server/prisma/db"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 100
+	cursorPrefix    = "cursor:"
+)
+
+// page is the window of a list requested with the Relay first/after/last/before arguments.
+// Cursors hold the primary key of an edge and are resolved by Prisma, so lists can be sorted on any field.
+type page struct {
+	after    *string
+	before   *string
+	limit    int
+	backward bool
+}
+
+func newPage(first *int, after *string, last *int, before *string) (page, error) {
+	p := page{limit: defaultPageSize}
+	if first != nil && last != nil {
+		return p, fmt.Errorf("first and last cannot be used together")
+	}
+	size := first
+	if last != nil || (first == nil && before != nil) {
+		size = last
+		p.backward = true
+	}
+	if (p.backward && after != nil) || (!p.backward && before != nil) {
+		return p, fmt.Errorf("after can only be used with first and before with last")
+	}
+	if size != nil {
+		if *size < 0 || *size > maxPageSize {
+			return p, fmt.Errorf("a page must contain between 0 and %d items", maxPageSize)
+		}
+		p.limit = *size
+	}
+	var err error
+	if p.after, err = decodeCursor(after); err != nil {
+		return p, err
+	}
+	if p.before, err = decodeCursor(before); err != nil {
+		return p, err
+	}
+	return p, nil
+}
+
+func encodeCursor(key string) string {
+	return b64.StdEncoding.EncodeToString([]byte(cursorPrefix + key))
+}
+
+func decodeCursor(cursor *string) (*string, error) {
+	if cursor == nil {
+		return nil, nil
+	}
+	decoded, err := b64.StdEncoding.DecodeString(*cursor)
+	if err != nil || !strings.HasPrefix(string(decoded), cursorPrefix) {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	key := strings.TrimPrefix(string(decoded), cursorPrefix)
+	return &key, nil
+}
+
+// cursor returns the key the page starts from, if any
+func (p page) cursor() *string {
+	if p.backward {
+		return p.before
+	}
+	return p.after
+}
+
+// intCursor returns the cursor of a list keyed by integers
+func (p page) intCursor() (*int, error) {
+	cursor := p.cursor()
+	if cursor == nil {
+		return nil, nil
+	}
+	id, err := strconv.Atoi(*cursor)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	return &id, nil
+}
+
+// direction returns the direction to fetch a list sorted in the given order, backward pages are read from the end
+func (p page) direction(order db.SortOrder) db.SortOrder {
+	if !p.backward {
+		return order
+	}
+	if order == db.SortOrderAsc {
+		return db.SortOrderDesc
+	}
+	return db.SortOrderAsc
+}
+
+// take returns how many items to fetch, one more than the page to know if there is a next one
+func (p page) take() int {
+	return p.limit + 1
+}
+
+// window returns the indexes of the fetched items to keep, in list order, and whether more items were left out
+func (p page) window(fetched int) ([]int, bool) {
+	hasMore := fetched > p.limit
+	if hasMore {
+		fetched = p.limit
+	}
+	indexes := make([]int, fetched)
+	for i := range indexes {
+		if p.backward {
+			indexes[i] = fetched - 1 - i
+		} else {
+			indexes[i] = i
+		}
+	}
+	return indexes, hasMore
+}
+
+func (p page) pageInfo(hasMore bool, cursors []string) *model.PageInfo {
+	info := &model.PageInfo{
+		HasNextPage:     hasMore,
+		HasPreviousPage: p.after != nil,
+	}
+	if p.backward {
+		info.HasNextPage = p.before != nil
+		info.HasPreviousPage = hasMore
+	}
+	if len(cursors) > 0 {
+		info.StartCursor = &cursors[0]
+		info.EndCursor = &cursors[len(cursors)-1]
+	}
+	return info
+}
+
+func contractConnection(contracts []db.ContractModel, p page) *model.ContractConnection {
+	indexes, hasMore := p.window(len(contracts))
+	edges := make([]model.ContractEdge, 0, len(indexes))
+	cursors := make([]string, 0, len(indexes))
+	for _, i := range indexes {
+		cursor := encodeCursor(strconv.Itoa(contracts[i].ID))
+		edges = append(edges, model.ContractEdge{Cursor: cursor, Node: &contracts[i]})
+		cursors = append(cursors, cursor)
+	}
+	return &model.ContractConnection{Edges: edges, PageInfo: p.pageInfo(hasMore, cursors)}
+}
+
+func groupConnection(groups []db.GroupModel, p page) *model.GroupConnection {
+	indexes, hasMore := p.window(len(groups))
+	edges := make([]model.GroupEdge, 0, len(indexes))
+	cursors := make([]string, 0, len(indexes))
+	for _, i := range indexes {
+		cursor := encodeCursor(strconv.Itoa(groups[i].ID))
+		edges = append(edges, model.GroupEdge{Cursor: cursor, Node: &groups[i]})
+		cursors = append(cursors, cursor)
+	}
+	return &model.GroupConnection{Edges: edges, PageInfo: p.pageInfo(hasMore, cursors)}
+}
+
+func skillConnection(skills []db.SkillModel, p page) *model.SkillConnection {
+	indexes, hasMore := p.window(len(skills))
+	edges := make([]model.SkillEdge, 0, len(indexes))
+	cursors := make([]string, 0, len(indexes))
+	for _, i := range indexes {
+		cursor := encodeCursor(strconv.Itoa(skills[i].ID))
+		edges = append(edges, model.SkillEdge{Cursor: cursor, Node: &skills[i]})
+		cursors = append(cursors, cursor)
+	}
+	return &model.SkillConnection{Edges: edges, PageInfo: p.pageInfo(hasMore, cursors)}
+}
+
+func studentConnection(students []db.StudentModel, p page) *model.StudentConnection {
+	indexes, hasMore := p.window(len(students))
+	edges := make([]model.StudentEdge, 0, len(indexes))
+	cursors := make([]string, 0, len(indexes))
+	for _, i := range indexes {
+		cursor := encodeCursor(students[i].OwnerID)
+		edges = append(edges, model.StudentEdge{Cursor: cursor, Node: &students[i]})
+		cursors = append(cursors, cursor)
+	}
+	return &model.StudentConnection{Edges: edges, PageInfo: p.pageInfo(hasMore, cursors)}
+}
+
+func teacherConnection(teachers []db.TeacherModel, p page) *model.TeacherConnection {
+	indexes, hasMore := p.window(len(teachers))
+	edges := make([]model.TeacherEdge, 0, len(indexes))
+	cursors := make([]string, 0, len(indexes))
+	for _, i := range indexes {
+		cursor := encodeCursor(teachers[i].OwnerID)
+		edges = append(edges, model.TeacherEdge{Cursor: cursor, Node: &teachers[i]})
+		cursors = append(cursors, cursor)
+	}
+	return &model.TeacherConnection{Edges: edges, PageInfo: p.pageInfo(hasMore, cursors)}
+}
+
+func (r *Resolver) contractPage(ctx context.Context, p page, orderBy *model.ContractOrderBy, params ...db.ContractWhereParam) (*model.ContractConnection, error) {
+	cursor, err := p.intCursor()
+	if err != nil {
+		return nil, err
+	}
+	query := r.Prisma.Contract.FindMany(params...).OrderBy(contractOrder(orderBy, p)...).Take(p.take())
+	if cursor != nil {
+		query = query.Cursor(db.Contract.ID.Cursor(*cursor)).Skip(1)
+	}
+	contracts, err := query.Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return contractConnection(contracts, p), nil
+}
+
+func (r *Resolver) groupPage(ctx context.Context, p page, params ...db.GroupWhereParam) (*model.GroupConnection, error) {
+	cursor, err := p.intCursor()
+	if err != nil {
+		return nil, err
+	}
+	query := r.Prisma.Group.FindMany(params...).OrderBy(db.Group.ID.Order(p.direction(db.SortOrderAsc))).Take(p.take())
+	if cursor != nil {
+		query = query.Cursor(db.Group.ID.Cursor(*cursor)).Skip(1)
+	}
+	groups, err := query.Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return groupConnection(groups, p), nil
+}
+
+func (r *Resolver) skillPage(ctx context.Context, p page, orderBy *model.SkillOrderBy, params ...db.SkillWhereParam) (*model.SkillConnection, error) {
+	cursor, err := p.intCursor()
+	if err != nil {
+		return nil, err
+	}
+	query := r.Prisma.Skill.FindMany(params...).OrderBy(skillOrder(orderBy, p)...).Take(p.take())
+	if cursor != nil {
+		query = query.Cursor(db.Skill.ID.Cursor(*cursor)).Skip(1)
+	}
+	skills, err := query.Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return skillConnection(skills, p), nil
+}
+
+func (r *Resolver) studentPage(ctx context.Context, p page, orderBy *model.StudentOrderBy, params ...db.StudentWhereParam) (*model.StudentConnection, error) {
+	query := r.Prisma.Student.FindMany(params...).OrderBy(studentOrder(orderBy, p)...).Take(p.take())
+	if cursor := p.cursor(); cursor != nil {
+		query = query.Cursor(db.Student.OwnerID.Cursor(*cursor)).Skip(1)
+	}
+	students, err := query.Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return studentConnection(students, p), nil
+}
+
+func (r *Resolver) teacherPage(ctx context.Context, p page) (*model.TeacherConnection, error) {
+	query := r.Prisma.Teacher.FindMany().OrderBy(db.Teacher.OwnerID.Order(p.direction(db.SortOrderAsc))).Take(p.take())
+	if cursor := p.cursor(); cursor != nil {
+		query = query.Cursor(db.Teacher.OwnerID.Cursor(*cursor)).Skip(1)
+	}
+	teachers, err := query.Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return teacherConnection(teachers, p), nil
+}
@@ -0,0 +1,208 @@
+package graph
+
+import (
+	b64 "encoding/base64"
+	"kontrakt-server/prisma/db"
+	"reflect"
+	"testing"
+)
+
+func intPointer(value int) *int {
+	return &value
+}
+
+func stringPointer(value string) *string {
+	return &value
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	for _, key := range []string{"42", "mdupont", "", "with:colon"} {
+		cursor := encodeCursor(key)
+		decoded, err := decodeCursor(&cursor)
+		if err != nil {
+			t.Fatalf("decodeCursor(encodeCursor(%q)) error = %v", key, err)
+		}
+		if *decoded != key {
+			t.Errorf("decodeCursor(encodeCursor(%q)) = %q", key, *decoded)
+		}
+	}
+}
+
+func TestDecodeCursor(t *testing.T) {
+	tests := []struct {
+		name    string
+		cursor  *string
+		want    *string
+		wantErr bool
+	}{
+		{"no cursor", nil, nil, false},
+		{"valid cursor", stringPointer(encodeCursor("12")), stringPointer("12"), false},
+		{"not base64", stringPointer("%%%"), nil, true},
+		{"missing prefix", stringPointer(b64.StdEncoding.EncodeToString([]byte("12"))), nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := decodeCursor(test.cursor)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("decodeCursor() error = %v, want error %v", err, test.wantErr)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("decodeCursor() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestNewPage(t *testing.T) {
+	cursor := encodeCursor("7")
+	tests := []struct {
+		name    string
+		first   *int
+		after   *string
+		last    *int
+		before  *string
+		want    page
+		wantErr bool
+	}{
+		{"default page", nil, nil, nil, nil, page{limit: defaultPageSize}, false},
+		{"first", intPointer(10), nil, nil, nil, page{limit: 10}, false},
+		{"first after", intPointer(10), &cursor, nil, nil, page{limit: 10, after: stringPointer("7")}, false},
+		{"last before", nil, nil, intPointer(5), &cursor, page{limit: 5, before: stringPointer("7"), backward: true}, false},
+		{"before alone reads backward", nil, nil, nil, &cursor, page{limit: defaultPageSize, before: stringPointer("7"), backward: true}, false},
+		{"empty page", intPointer(0), nil, nil, nil, page{limit: 0}, false},
+		{"largest page", intPointer(maxPageSize), nil, nil, nil, page{limit: maxPageSize}, false},
+		{"first and last", intPointer(1), nil, intPointer(1), nil, page{}, true},
+		{"first before", intPointer(1), nil, nil, &cursor, page{}, true},
+		{"last after", nil, &cursor, intPointer(1), nil, page{}, true},
+		{"negative size", intPointer(-1), nil, nil, nil, page{}, true},
+		{"page too large", intPointer(maxPageSize + 1), nil, nil, nil, page{}, true},
+		{"invalid cursor", intPointer(1), stringPointer("nope"), nil, nil, page{}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := newPage(test.first, test.after, test.last, test.before)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("newPage() error = %v, want error %v", err, test.wantErr)
+			}
+			if !test.wantErr && !reflect.DeepEqual(got, test.want) {
+				t.Errorf("newPage() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestPageIntCursor(t *testing.T) {
+	tests := []struct {
+		name    string
+		page    page
+		want    *int
+		wantErr bool
+	}{
+		{"no cursor", page{}, nil, false},
+		{"after", page{after: stringPointer("3")}, intPointer(3), false},
+		{"before when backward", page{before: stringPointer("4"), backward: true}, intPointer(4), false},
+		{"not a number", page{after: stringPointer("mdupont")}, nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := test.page.intCursor()
+			if (err != nil) != test.wantErr {
+				t.Fatalf("intCursor() error = %v, want error %v", err, test.wantErr)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("intCursor() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestPageDirection(t *testing.T) {
+	tests := []struct {
+		name  string
+		page  page
+		order db.SortOrder
+		want  db.SortOrder
+	}{
+		{"forward keeps ascending", page{}, db.SortOrderAsc, db.SortOrderAsc},
+		{"forward keeps descending", page{}, db.SortOrderDesc, db.SortOrderDesc},
+		{"backward reverses ascending", page{backward: true}, db.SortOrderAsc, db.SortOrderDesc},
+		{"backward reverses descending", page{backward: true}, db.SortOrderDesc, db.SortOrderAsc},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.page.direction(test.order); got != test.want {
+				t.Errorf("direction(%v) = %v, want %v", test.order, got, test.want)
+			}
+		})
+	}
+}
+
+func TestPageWindow(t *testing.T) {
+	tests := []struct {
+		name        string
+		page        page
+		fetched     int
+		wantIndexes []int
+		wantMore    bool
+	}{
+		{"nothing fetched", page{limit: 3}, 0, []int{}, false},
+		{"partial page", page{limit: 3}, 2, []int{0, 1}, false},
+		{"full page", page{limit: 3}, 3, []int{0, 1, 2}, false},
+		{"extra item means more", page{limit: 3}, 4, []int{0, 1, 2}, true},
+		{"backward pages are reversed", page{limit: 3, backward: true}, 3, []int{2, 1, 0}, false},
+		{"backward extra item", page{limit: 3, backward: true}, 4, []int{2, 1, 0}, true},
+		{"empty page", page{limit: 0}, 1, []int{}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			indexes, hasMore := test.page.window(test.fetched)
+			if !reflect.DeepEqual(indexes, test.wantIndexes) || hasMore != test.wantMore {
+				t.Errorf("window(%d) = %v, %v, want %v, %v", test.fetched, indexes, hasMore, test.wantIndexes, test.wantMore)
+			}
+		})
+	}
+}
+
+func TestPagePageInfo(t *testing.T) {
+	tests := []struct {
+		name         string
+		page         page
+		hasMore      bool
+		wantNext     bool
+		wantPrevious bool
+	}{
+		{"first page", page{}, true, true, false},
+		{"last page", page{after: stringPointer("1")}, false, false, true},
+		{"middle page", page{after: stringPointer("1")}, true, true, true},
+		{"backward from the end", page{backward: true}, true, false, true},
+		{"backward before a cursor", page{before: stringPointer("9"), backward: true}, false, true, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			info := test.page.pageInfo(test.hasMore, []string{"a", "b"})
+			if info.HasNextPage != test.wantNext || info.HasPreviousPage != test.wantPrevious {
+				t.Errorf("pageInfo() next = %v, previous = %v, want %v, %v", info.HasNextPage, info.HasPreviousPage, test.wantNext, test.wantPrevious)
+			}
+			if *info.StartCursor != "a" || *info.EndCursor != "b" {
+				t.Errorf("pageInfo() cursors = %s, %s, want a, b", *info.StartCursor, *info.EndCursor)
+			}
+		})
+	}
+	if info := (page{}).pageInfo(false, nil); info.StartCursor != nil || info.EndCursor != nil {
+		t.Errorf("pageInfo() of an empty page has cursors")
+	}
+}
+
+func TestContractConnection(t *testing.T) {
+	contracts := []db.ContractModel{{InnerContract: db.InnerContract{ID: 3}}, {InnerContract: db.InnerContract{ID: 2}}, {InnerContract: db.InnerContract{ID: 1}}}
+	connection := contractConnection(contracts, page{limit: 2, backward: true})
+	if len(connection.Edges) != 2 || connection.Edges[0].Node.ID != 2 || connection.Edges[1].Node.ID != 3 {
+		t.Fatalf("contractConnection() edges = %+v, want contracts 2 and 3 in list order", connection.Edges)
+	}
+	if key, err := decodeCursor(&connection.Edges[0].Cursor); err != nil || *key != "2" {
+		t.Errorf("contractConnection() cursor = %s, want the id of the contract", connection.Edges[0].Cursor)
+	}
+	if !connection.PageInfo.HasPreviousPage {
+		t.Errorf("contractConnection() should have a previous page")
+	}
+}
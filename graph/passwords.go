@@ -0,0 +1,20 @@
+package graph
+
+import "fmt"
+
+const (
+	minPasswordLength = 8
+	// bcrypt ignores what comes after 72 bytes
+	maxPasswordLength = 72
+)
+
+// validatePassword makes sure a password chosen by a user is long enough and fully taken into account by bcrypt
+func validatePassword(password string) error {
+	if len(password) < minPasswordLength {
+		return fmt.Errorf("the password must be at least %d characters long", minPasswordLength)
+	}
+	if len(password) > maxPasswordLength {
+		return fmt.Errorf("the password cannot be longer than %d bytes", maxPasswordLength)
+	}
+	return nil
+}
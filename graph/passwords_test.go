@@ -0,0 +1,29 @@
+package graph
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidatePassword(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		wantErr  bool
+	}{
+		{"empty", "", true},
+		{"too short", "secret1", true},
+		{"shortest", "secret12", false},
+		{"accented letters count as bytes", "écoleé", false},
+		{"longest", strings.Repeat("a", 72), false},
+		{"longer than bcrypt reads", strings.Repeat("a", 73), true},
+		{"multibyte past the limit", strings.Repeat("é", 37), true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := validatePassword(test.password); (err != nil) != test.wantErr {
+				t.Errorf("validatePassword(%q) error = %v, want error %v", test.password, err, test.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,290 @@
+package graph
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"kontrakt-server/prisma/db"
+	"kontrakt-server/utils"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jung-kurt/gofpdf"
+)
+
+const (
+	reportURLDuration = 15 * time.Minute
+	pdfContentType    = "application/pdf"
+	zipContentType    = "application/zip"
+	// Widths in millimeters of the columns of the skill tables, an A4 page fits 190 between its margins
+	reportSkillWidth = 115
+	reportMarkWidth  = 75
+	reportLineHeight = 5
+)
+
+func studentReportPath(username string) string {
+	return "/reports/students/" + username
+}
+
+func groupReportPath(groupID int) string {
+	return fmt.Sprintf("/reports/groups/%d", groupID)
+}
+
+// createStudentReport returns a short-lived signed link to download the progress report of a student
+func (r *Resolver) createStudentReport(ctx context.Context, username string) (string, error) {
+	if err := r.authorizeStudent(ctx, username); err != nil {
+		return "", err
+	}
+	if _, err := r.Prisma.Student.FindUnique(db.Student.OwnerID.Equals(username)).Exec(ctx); err != nil {
+		return "", err
+	}
+	return utils.SignURL(studentReportPath(username), time.Now().Add(reportURLDuration)), nil
+}
+
+// createGroupReports returns a short-lived signed link to download the progress reports of the students of a group
+func (r *Resolver) createGroupReports(ctx context.Context, groupID int) (string, error) {
+	if _, err := r.Prisma.Group.FindUnique(db.Group.ID.Equals(groupID)).Exec(ctx); err != nil {
+		return "", err
+	}
+	return utils.SignURL(groupReportPath(groupID), time.Now().Add(reportURLDuration)), nil
+}
+
+// StudentReportHandler sends the PDF progress report of a student to whoever holds a valid signed link
+func (r *Resolver) StudentReportHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		username := mux.Vars(req)["username"]
+		if err := utils.VerifySignedURL(studentReportPath(username), req.URL.Query()); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		pdf, err := r.buildStudentReport(req.Context(), username)
+		if errors.Is(err, db.ErrNotFound) {
+			http.NotFound(w, req)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", pdfContentType)
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": reportFilename(username)}))
+		w.Header().Set("Cache-Control", "no-store")
+		if err := pdf.Output(w); err != nil {
+			log.Printf("could not send the report of %s: %v", username, err)
+		}
+	})
+}
+
+// GroupReportHandler sends a zip of the PDF progress reports of the students of a group to whoever holds a valid signed link
+func (r *Resolver) GroupReportHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		groupID, err := strconv.Atoi(mux.Vars(req)["id"])
+		if err != nil {
+			http.NotFound(w, req)
+			return
+		}
+		if err := utils.VerifySignedURL(groupReportPath(groupID), req.URL.Query()); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		group, err := r.Prisma.Group.FindUnique(db.Group.ID.Equals(groupID)).With(db.Group.Students.Fetch()).Exec(req.Context())
+		if errors.Is(err, db.ErrNotFound) {
+			http.NotFound(w, req)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", zipContentType)
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": fmt.Sprintf("bilans-%s.zip", group.Name)}))
+		w.Header().Set("Cache-Control", "no-store")
+		// The reports are streamed one by one so the status cannot change once the first one is sent.
+		// A student whose report cannot be built is left out rather than cutting the archive short.
+		archive := zip.NewWriter(w)
+		defer func() {
+			if err := archive.Close(); err != nil {
+				log.Printf("could not send the reports of group %d: %v", groupID, err)
+			}
+		}()
+		for _, student := range sortedStudents(group.Students()) {
+			pdf, err := r.buildStudentReport(req.Context(), student.OwnerID)
+			if err != nil {
+				log.Printf("could not build the report of %s: %v", student.OwnerID, err)
+				continue
+			}
+			entry, err := archive.Create(reportFilename(student.OwnerID))
+			if err == nil {
+				err = pdf.Output(entry)
+			}
+			// The connection is gone, the other reports could not be sent either
+			if err != nil {
+				log.Printf("could not add the report of %s: %v", student.OwnerID, err)
+				return
+			}
+		}
+	})
+}
+
+func reportFilename(username string) string {
+	return fmt.Sprintf("bilan-%s.pdf", username)
+}
+
+// buildStudentReport returns a PDF listing the current contracts of a student with the mark and teacher comments of each skill
+func (r *Resolver) buildStudentReport(ctx context.Context, username string) (*gofpdf.Fpdf, error) {
+	student, err := r.Prisma.Student.FindUnique(db.Student.OwnerID.Equals(username)).With(db.Student.Groups.Fetch()).Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	contracts, err := r.Prisma.Contract.FindMany(studentContracts(username), db.Contract.Archived.Equals(false)).OrderBy(db.Contract.Start.Order(db.SortOrderAsc), db.Contract.ID.Order(db.SortOrderAsc)).With(
+		db.Contract.Skills.Fetch().OrderBy(db.Skill.Position.Order(db.SortOrderAsc), db.Skill.ID.Order(db.SortOrderAsc)).With(
+			db.Skill.StudentSkills.Fetch(db.StudentSkill.StudentID.Equals(username)),
+			db.Skill.Comments.Fetch(db.StudentSkillComment.StudentID.Equals(username), db.StudentSkillComment.Author.Where(db.User.Role.In([]db.Role{db.RoleTEACHER, db.RoleADMIN}))).OrderBy(db.StudentSkillComment.CreatedAt.Order(db.SortOrderAsc)).With(
+				db.StudentSkillComment.Author.Fetch().With(db.User.Teacher.Fetch()),
+			),
+		),
+		db.Contract.Categories.Fetch().OrderBy(db.SkillCategory.Position.Order(db.SortOrderAsc), db.SkillCategory.ID.Order(db.SortOrderAsc)),
+		db.Contract.MarkScale.Fetch().With(db.MarkScale.Levels.Fetch()),
+	).Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	// The core fonts only know the Windows-1252 characters, which cover French
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	pdf.SetTitle(tr("Bilan de "+student.FirstName+" "+student.LastName), false)
+	pdf.SetAutoPageBreak(true, 15)
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-12)
+		pdf.SetFont("Helvetica", "I", 8)
+		pdf.SetTextColor(120, 120, 120)
+		pdf.CellFormat(0, 5, tr(fmt.Sprintf("%s %s - page %d", student.FirstName, student.LastName, pdf.PageNo())), "", 0, "C", false, 0, "")
+	})
+	pdf.AddPage()
+
+	pdf.SetFont("Helvetica", "B", 18)
+	pdf.CellFormat(0, 10, tr("Bilan de "+student.FirstName+" "+student.LastName), "", 1, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 10)
+	var groupNames []string
+	for _, group := range student.Groups() {
+		groupNames = append(groupNames, group.Name)
+	}
+	if len(groupNames) > 0 {
+		pdf.CellFormat(0, 6, tr("Groupes : "+strings.Join(groupNames, ", ")), "", 1, "L", false, 0, "")
+	}
+	pdf.CellFormat(0, 6, tr("Édité le "+time.Now().Format("02/01/2006")), "", 1, "L", false, 0, "")
+	pdf.Ln(4)
+	if len(contracts) == 0 {
+		pdf.CellFormat(0, 6, tr("Aucun contrat en cours."), "", 1, "L", false, 0, "")
+	}
+
+	for _, contract := range contracts {
+		var levels []db.MarkScaleLevelModel
+		if markScale, ok := contract.MarkScale(); ok {
+			levels = markScale.Levels()
+		}
+		// Keep the title of a contract with its first skill
+		if pdf.GetY() > 250 {
+			pdf.AddPage()
+		}
+		red, green, blue := hexColorRGB(contract.HexColor)
+		pdf.SetFillColor(red, green, blue)
+		pdf.Rect(10, pdf.GetY(), 2, 8, "F")
+		pdf.SetX(14)
+		pdf.SetFont("Helvetica", "B", 13)
+		pdf.SetTextColor(0, 0, 0)
+		pdf.CellFormat(0, 8, tr(contract.Name), "", 1, "L", false, 0, "")
+		pdf.SetFont("Helvetica", "", 9)
+		pdf.SetTextColor(90, 90, 90)
+		pdf.CellFormat(0, 5, tr(fmt.Sprintf("Du %s au %s", contract.Start.Format("02/01/2006"), contract.End.Format("02/01/2006"))), "", 1, "L", false, 0, "")
+		pdf.Ln(2)
+		if len(contract.Skills()) == 0 {
+			pdf.SetTextColor(0, 0, 0)
+			pdf.CellFormat(0, 6, tr("Aucune compétence."), "", 1, "L", false, 0, "")
+		}
+		for _, group := range skillColumnGroups(contract.Skills(), contract.Categories()) {
+			if group.category != "" {
+				pdf.SetFont("Helvetica", "B", 10)
+				pdf.SetTextColor(0, 0, 0)
+				pdf.CellFormat(0, 7, tr(group.category), "", 1, "L", false, 0, "")
+			}
+			for _, skill := range group.skills {
+				mark := db.MarkTODO
+				if studentSkills := skill.StudentSkills(); len(studentSkills) > 0 {
+					mark = studentSkills[0].Mark
+				}
+				writeReportSkill(pdf, tr, skill, utils.GetScaleMarkData(levels, mark))
+			}
+		}
+		pdf.Ln(6)
+	}
+	return pdf, pdf.Error()
+}
+
+// writeReportSkill adds a row with the name and mark of a skill followed by the comments of teachers
+func writeReportSkill(pdf *gofpdf.Fpdf, tr func(string) string, skill db.SkillModel, markData utils.MarkData) {
+	pdf.SetFont("Helvetica", "", 10)
+	nameLines := pdf.SplitLines([]byte(tr(skill.Name)), reportSkillWidth-2)
+	markLines := pdf.SplitLines([]byte(tr(markData.Text)), reportMarkWidth-2)
+	lines := len(nameLines)
+	if len(markLines) > lines {
+		lines = len(markLines)
+	}
+	height := float64(lines*reportLineHeight + 2)
+	_, pageHeight := pdf.GetPageSize()
+	_, _, _, bottomMargin := pdf.GetMargins()
+	if pdf.GetY()+height > pageHeight-bottomMargin {
+		pdf.AddPage()
+	}
+	x, y := pdf.GetXY()
+	pdf.SetTextColor(0, 0, 0)
+	pdf.SetDrawColor(200, 200, 200)
+	pdf.Rect(x, y, reportSkillWidth, height, "D")
+	for i, line := range nameLines {
+		pdf.SetXY(x+1, y+1+float64(i*reportLineHeight))
+		pdf.CellFormat(reportSkillWidth-2, reportLineHeight, string(line), "", 0, "L", false, 0, "")
+	}
+	red, green, blue := hexColorRGB(markData.Color)
+	pdf.SetFillColor(red, green, blue)
+	pdf.Rect(x+reportSkillWidth, y, reportMarkWidth, height, "FD")
+	// Dark marks are written in white to stay readable
+	if red*299+green*587+blue*114 < 128000 {
+		pdf.SetTextColor(255, 255, 255)
+	}
+	for i, line := range markLines {
+		pdf.SetXY(x+reportSkillWidth+1, y+1+float64(i*reportLineHeight))
+		pdf.CellFormat(reportMarkWidth-2, reportLineHeight, string(line), "", 0, "C", false, 0, "")
+	}
+	pdf.SetXY(x, y+height)
+	pdf.SetTextColor(60, 60, 60)
+	pdf.SetFont("Helvetica", "I", 9)
+	for _, comment := range skill.Comments() {
+		pdf.SetX(x + 4)
+		pdf.MultiCell(reportSkillWidth+reportMarkWidth-4, 4.5, tr(authorName(comment.Author())+" : "+comment.Body), "", "L", false)
+	}
+	pdf.SetX(x)
+}
+
+// authorName returns the name of the teacher who wrote a comment, or their username when they have no teacher profile
+func authorName(author *db.UserModel) string {
+	if teachers := author.Teacher(); len(teachers) > 0 {
+		return teachers[0].FirstName + " " + teachers[0].LastName
+	}
+	return author.Username
+}
+
+// hexColorRGB reads a color written as #rrggbb, anything else is read as grey
+func hexColorRGB(hexColor string) (int, int, int) {
+	value, err := strconv.ParseUint(strings.TrimPrefix(hexColor, "#"), 16, 32)
+	if err != nil || len(hexColor) != 7 {
+		return 163, 163, 163
+	}
+	return int(value >> 16 & 0xff), int(value >> 8 & 0xff), int(value & 0xff)
+}
@@ -1,11 +1,19 @@
 package graph
 
-import "kontrakt-server/prisma/db"
+import (
+	"kontrakt-server/prisma/db"
+	"kontrakt-server/pubsub"
+	"kontrakt-server/storage"
+)
 
 // This file will not be regenerated automatically.
 //
 // It serves as dependency injection for your app, add any dependencies you require here.
 
 type Resolver struct{
-	Prisma *db.PrismaClient
+	Prisma  *db.PrismaClient
+	Storage storage.Storage
+	Broker  pubsub.Broker
+	// MaxAttachmentSize is the largest file that can be uploaded, in bytes
+	MaxAttachmentSize int64
 }
@@ -5,9 +5,8 @@ package graph
 
 import (
 	"context"
-	b64 "encoding/base64"
+	"errors"
 	"fmt"
-	"github.com/xuri/excelize/v2"
 	"kontrakt-server/dataloader"
 	"kontrakt-server/graph/auth"
 	"kontrakt-server/graph/generated"
@@ -17,323 +16,1211 @@ import (
 	"strings"
 	"time"
 
+	"github.com/99designs/gqlgen/graphql"
 	"github.com/prisma/prisma-client-go/runtime/transaction"
 	"golang.org/x/crypto/bcrypt"
 )
 
-func (r *contractResolver) End(ctx context.Context, obj *db.ContractModel) (string, error) {
-	return obj.End.String(), nil
+func (r *attachmentResolver) UploaderUsername(ctx context.Context, obj *db.AttachmentModel) (string, error) {
+	return obj.UploaderID, nil
 }
 
-func (r *contractResolver) Start(ctx context.Context, obj *db.ContractModel) (string, error) {
-	return obj.Start.String(), nil
+func (r *attachmentResolver) URL(ctx context.Context, obj *db.AttachmentModel) (string, error) {
+	if err := r.authorizeStudent(ctx, obj.StudentID); err != nil {
+		return "", err
+	}
+	return utils.SignURL(attachmentPath(obj.ID), time.Now().Add(attachmentURLDuration)), nil
+}
+
+func (r *competencyResolver) Domain(ctx context.Context, obj *db.CompetencyModel) (*db.CompetencyDomainModel, error) {
+	return r.Prisma.CompetencyDomain.FindUnique(db.CompetencyDomain.ID.Equals(obj.DomainID)).Exec(ctx)
 }
 
-func (r *contractResolver) Skills(ctx context.Context, obj *db.ContractModel) ([]db.SkillModel, error) {
-	return dataloader.For(ctx).SkillsByContractID.Load(obj.ID)
+func (r *competencyResolver) Skills(ctx context.Context, obj *db.CompetencyModel) ([]db.SkillModel, error) {
+	params := []db.SkillWhereParam{db.Skill.CompetencyID.Equals(obj.ID)}
+	// Students only see the skills of the contracts they can open
+	if me, restricted := restrictedStudent(ctx); restricted {
+		params = append(params, db.Skill.Contract.Where(studentContracts(me), db.Contract.Archived.Equals(false)))
+	}
+	return r.Prisma.Skill.FindMany(params...).OrderBy(db.Skill.ContractID.Order(db.SortOrderAsc), db.Skill.Position.Order(db.SortOrderAsc)).Exec(ctx)
+}
+
+func (r *competencyDomainResolver) Competencies(ctx context.Context, obj *db.CompetencyDomainModel) ([]db.CompetencyModel, error) {
+	return r.Prisma.Competency.FindMany(db.Competency.DomainID.Equals(obj.ID)).OrderBy(db.Competency.Position.Order(db.SortOrderAsc), db.Competency.ID.Order(db.SortOrderAsc)).Exec(ctx)
+}
+
+func (r *contractResolver) Skills(ctx context.Context, obj *db.ContractModel, filter *model.SkillFilter, orderBy *model.SkillOrderBy, first *int, after *string, last *int, before *string) (*model.SkillConnection, error) {
+	p, err := newPage(first, after, last, before)
+	if err != nil {
+		return nil, err
+	}
+	params, err := skillWhere(filter)
+	if err != nil {
+		return nil, err
+	}
+	return r.skillPage(ctx, p, orderBy, append(params, db.Skill.ContractID.Equals(obj.ID))...)
 }
 
 func (r *contractResolver) Groups(ctx context.Context, obj *db.ContractModel) ([]db.GroupModel, error) {
 	return dataloader.For(ctx).GroupsByContractID.Load(obj.ID)
 }
 
+func (r *contractResolver) MarkScale(ctx context.Context, obj *db.ContractModel) (*db.MarkScaleModel, error) {
+	markScaleID, ok := obj.MarkScaleID()
+	if !ok {
+		return nil, nil
+	}
+	return r.Prisma.MarkScale.FindUnique(db.MarkScale.ID.Equals(markScaleID)).Exec(ctx)
+}
+
+func (r *contractResolver) Categories(ctx context.Context, obj *db.ContractModel) ([]db.SkillCategoryModel, error) {
+	return r.Prisma.SkillCategory.FindMany(db.SkillCategory.ContractID.Equals(obj.ID)).OrderBy(db.SkillCategory.Position.Order(db.SortOrderAsc), db.SkillCategory.ID.Order(db.SortOrderAsc)).Exec(ctx)
+}
+
+func (r *contractTemplateResolver) Description(ctx context.Context, obj *db.ContractTemplateModel) (*string, error) {
+	return optionalString(obj.Description()), nil
+}
+
+func (r *contractTemplateResolver) Skills(ctx context.Context, obj *db.ContractTemplateModel) ([]db.TemplateSkillModel, error) {
+	return r.Prisma.TemplateSkill.FindMany(db.TemplateSkill.TemplateID.Equals(obj.ID)).OrderBy(db.TemplateSkill.Position.Order(db.SortOrderAsc)).Exec(ctx)
+}
+
 func (r *groupResolver) Contracts(ctx context.Context, obj *db.GroupModel) ([]db.ContractModel, error) {
-	return dataloader.For(ctx).ContractsByGroupID.Load(obj.ID)
+	contracts, err := dataloader.For(ctx).ContractsByGroupID.Load(obj.ID)
+	if err != nil {
+		return nil, err
+	}
+	if _, restricted := restrictedStudent(ctx); !restricted {
+		return contracts, nil
+	}
+	// Students do not see archived contracts
+	var visible []db.ContractModel
+	for _, contract := range contracts {
+		if !contract.Archived {
+			visible = append(visible, contract)
+		}
+	}
+	return visible, nil
+}
+
+func (r *groupResolver) Students(ctx context.Context, obj *db.GroupModel, filter *model.StudentFilter, orderBy *model.StudentOrderBy, first *int, after *string, last *int, before *string) (*model.StudentConnection, error) {
+	p, err := newPage(first, after, last, before)
+	if err != nil {
+		return nil, err
+	}
+	params, err := studentWhere(filter)
+	if err != nil {
+		return nil, err
+	}
+	params = append(params, db.Student.Groups.Some(db.Group.ID.Equals(obj.ID)))
+	// Students only see themselves among their classmates
+	if me, restricted := restrictedStudent(ctx); restricted {
+		params = append(params, db.Student.OwnerID.Equals(me))
+	}
+	return r.studentPage(ctx, p, orderBy, params...)
 }
 
-func (r *groupResolver) Students(ctx context.Context, obj *db.GroupModel) ([]db.StudentModel, error) {
-	return dataloader.For(ctx).StudentsByGroupID.Load(obj.ID)
+func (r *markScaleResolver) Levels(ctx context.Context, obj *db.MarkScaleModel) ([]db.MarkScaleLevelModel, error) {
+	return r.Prisma.MarkScaleLevel.FindMany(db.MarkScaleLevel.ScaleID.Equals(obj.ID)).OrderBy(db.MarkScaleLevel.Position.Order(db.SortOrderAsc)).Exec(ctx)
+}
+
+func (r *markScaleLevelResolver) Mark(ctx context.Context, obj *db.MarkScaleLevelModel) (model.Mark, error) {
+	return model.Mark(obj.Mark), nil
 }
 
 func (r *mutationResolver) Login(ctx context.Context, username string, password string) (*model.AuthPayload, error) {
+	usernameKey := usernameThrottleKey(username)
+	ipKey := ipThrottleKey(auth.IPForContext(ctx))
+	if err := r.registerLoginAttempt(ctx, usernameKey, usernameThrottle); err != nil {
+		return nil, err
+	}
+	if err := r.registerLoginAttempt(ctx, ipKey, ipThrottle); err != nil {
+		return nil, err
+	}
 	user, err := r.Prisma.User.FindUnique(db.User.Username.Equals(username)).Exec(ctx)
+	if err != nil && !errors.Is(err, db.ErrNotFound) {
+		return nil, err
+	}
+	// Compare against a dummy hash for unknown users so both cases take the same time
+	hashedPassword := dummyPasswordHash
+	if user != nil {
+		hashedPassword = []byte(user.Password)
+	}
+	err = bcrypt.CompareHashAndPassword(hashedPassword, []byte(password))
+	// The attempt is already counted as a failure
+	if user == nil || err != nil {
+		return nil, errInvalidCredentials
+	}
+	if err := r.clearLoginThrottle(ctx, usernameKey); err != nil {
+		return nil, err
+	}
+	if err := r.forgiveLoginAttempt(ctx, ipKey, ipThrottle); err != nil {
+		return nil, err
+	}
+	return r.createSession(ctx, user)
+}
+
+func (r *mutationResolver) RefreshToken(ctx context.Context, refreshToken string) (*model.AuthPayload, error) {
+	return r.rotateSession(ctx, refreshToken)
+}
+
+func (r *mutationResolver) Logout(ctx context.Context) (bool, error) {
+	session := auth.SessionForContext(ctx)
+	_, err := r.Prisma.Session.FindUnique(db.Session.ID.Equals(session.ID)).Update(db.Session.Revoked.Set(true)).Exec(ctx)
 	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (r *mutationResolver) RevokeSession(ctx context.Context, id string) (*db.SessionModel, error) {
+	session, err := r.Prisma.Session.FindUnique(db.Session.ID.Equals(id)).Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.authorizeAccount(ctx, session.OwnerID); err != nil {
 		return nil, err
 	}
-	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
+	return r.Prisma.Session.FindUnique(db.Session.ID.Equals(id)).Update(db.Session.Revoked.Set(true)).Exec(ctx)
+}
+
+func (r *mutationResolver) RevokeAllSessions(ctx context.Context, username string) (int, error) {
+	if err := r.authorizeAccount(ctx, username); err != nil {
+		return 0, err
+	}
+	result, err := r.Prisma.Session.FindMany(db.Session.OwnerID.Equals(username), db.Session.Revoked.Equals(false)).Update(db.Session.Revoked.Set(true)).Exec(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return result.Count, nil
+}
+
+func (r *mutationResolver) ChangeMyPassword(ctx context.Context, oldPassword string, newPassword string) (bool, error) {
+	user := auth.ForContext(ctx)
+	err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(oldPassword))
+	if err != nil {
+		return false, fmt.Errorf("bad password")
+	}
+	if newPassword == oldPassword {
+		return false, fmt.Errorf("the new password must be different from the old one")
+	}
+	if err := validatePassword(newPassword); err != nil {
+		return false, err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return false, err
+	}
+	_, err = r.Prisma.User.FindUnique(db.User.Username.Equals(user.Username)).Update(db.User.Password.Set(string(hashedPassword)), db.User.MustChangePassword.Set(false)).Exec(ctx)
+	if err != nil {
+		return false, err
+	}
+	// Log out every other device
+	session := auth.SessionForContext(ctx)
+	_, err = r.Prisma.Session.FindMany(db.Session.OwnerID.Equals(user.Username), db.Session.Not(db.Session.ID.Equals(session.ID))).Update(db.Session.Revoked.Set(true)).Exec(ctx)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (r *mutationResolver) ResetUserPassword(ctx context.Context, username string) (string, error) {
+	user, err := r.Prisma.User.FindUnique(db.User.Username.Equals(username)).Exec(ctx)
+	if err != nil {
+		return "", err
+	}
+	// Only users with a higher role can reset a password, so teachers cannot take over each other's accounts
+	if auth.HasRole(user, auth.ForContext(ctx).Role) {
+		return "", auth.Forbidden()
+	}
+	temporaryPassword, err := utils.RandomToken(4)
+	if err != nil {
+		return "", err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(temporaryPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	_, err = r.Prisma.User.FindUnique(db.User.Username.Equals(username)).Update(db.User.Password.Set(string(hashedPassword)), db.User.MustChangePassword.Set(true)).Exec(ctx)
+	if err != nil {
+		return "", err
+	}
+	_, err = r.Prisma.Session.FindMany(db.Session.OwnerID.Equals(username), db.Session.Revoked.Equals(false)).Update(db.Session.Revoked.Set(true)).Exec(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("bad password")
+		return "", err
+	}
+	return temporaryPassword, nil
+}
+
+func (r *mutationResolver) UpdateUserRole(ctx context.Context, username string, role model.Role) (*model.User, error) {
+	if auth.ForContext(ctx).Username == username {
+		return nil, fmt.Errorf("you cannot change your own role")
+	}
+	user, err := r.Prisma.User.FindUnique(db.User.Username.Equals(username)).With(db.User.Student.Fetch(), db.User.Teacher.Fetch()).Exec(ctx)
+	if err != nil {
+		return nil, err
 	}
-	token, err := utils.GetToken(user.Username)
+	// Students and staff have different profiles, only move users between roles sharing the same one
+	if role == model.RoleStudent && len(user.Student()) == 0 {
+		return nil, fmt.Errorf("%s has no student profile", username)
+	}
+	if role != model.RoleStudent && len(user.Teacher()) == 0 {
+		return nil, fmt.Errorf("%s has no teacher profile", username)
+	}
+	user, err = r.Prisma.User.FindUnique(db.User.Username.Equals(username)).Update(db.User.Role.Set(db.Role(role))).Exec(ctx)
 	if err != nil {
 		return nil, err
 	}
-	return &model.AuthPayload{
-		Token: token,
-		User: &model.User{
-			Username: user.Username,
-			Role:     model.Role(user.Role),
-		},
+	return &model.User{
+		Username: user.Username,
+		Role:     model.Role(user.Role),
 	}, nil
 }
 
+func (r *mutationResolver) UnlockUser(ctx context.Context, username string) (bool, error) {
+	if err := r.authorizeAccount(ctx, username); err != nil {
+		return false, err
+	}
+	if err := r.clearLoginThrottle(ctx, usernameThrottleKey(username)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 func (r *mutationResolver) CreateOneGroup(ctx context.Context, name string, contractID *int) (*db.GroupModel, error) {
 	var param []db.GroupSetParam
 	if contractID != nil {
 		param = append(param, db.Group.Contracts.Link(db.Contract.ID.Equals(*contractID)))
 	}
-	return r.Prisma.Group.CreateOne(db.Group.Name.Set(name), param...).Exec(ctx)
+	return r.Prisma.Group.CreateOne(db.Group.Name.Set(name), param...).Exec(ctx)
+}
+
+func (r *mutationResolver) UpdateOneContract(ctx context.Context, contractID int, groupIDs []int, name *string, hexColor *string, start *time.Time, end *time.Time, archived *bool, skills []model.ContractSkillInput) (*db.ContractModel, error) {
+	contract, err := r.Prisma.Contract.FindUnique(db.Contract.ID.Equals(contractID)).With(db.Contract.Skills.Fetch()).Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var param []db.ContractSetParam
+	if name != nil {
+		trimmed := strings.TrimSpace(*name)
+		if len(trimmed) == 0 {
+			return nil, fmt.Errorf("a contract needs a name")
+		}
+		param = append(param, db.Contract.Name.Set(trimmed))
+	}
+	if hexColor != nil {
+		if err := r.validateContractColor(ctx, contractID, *hexColor); err != nil {
+			return nil, err
+		}
+		param = append(param, db.Contract.HexColor.Set(*hexColor))
+	}
+	// Dates are checked against the current ones when only one of them changes
+	newStart, newEnd := contract.Start, contract.End
+	if start != nil {
+		newStart = *start
+	}
+	if end != nil {
+		newEnd = *end
+	}
+	if err := validateContractDates(newStart, newEnd); err != nil {
+		return nil, err
+	}
+	param = append(param, db.Contract.Start.SetIfPresent(start), db.Contract.End.SetIfPresent(end), db.Contract.Archived.SetIfPresent(archived))
+
+	transactions := []transaction.Param{r.Prisma.Contract.FindUnique(db.Contract.ID.Equals(contractID)).Update(param...).Tx()}
+	if groupIDs != nil {
+		groupChanges, err := r.contractGroupChanges(ctx, contractID, groupIDs)
+		if err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, groupChanges...)
+	}
+	var storageKeys []string
+	if skills != nil {
+		var skillChanges []transaction.Param
+		skillChanges, storageKeys, err = r.contractSkillChanges(ctx, contract, skills)
+		if err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, skillChanges...)
+	}
+	if err := r.Prisma.Prisma.Transaction(transactions...).Exec(ctx); err != nil {
+		return nil, err
+	}
+	if err := r.deleteStoredFiles(ctx, storageKeys); err != nil {
+		return nil, err
+	}
+	r.publishContractChanged(ctx, contractID)
+	return r.Prisma.Contract.FindUnique(db.Contract.ID.Equals(contractID)).Exec(ctx)
+}
+
+func (r *mutationResolver) CreateOneSkill(ctx context.Context, name string, contractID int, description *string, categoryID *int) (*db.SkillModel, error) {
+	// New skills go after the existing ones
+	skills, err := r.Prisma.Skill.FindMany(db.Skill.ContractID.Equals(contractID)).OrderBy(db.Skill.Position.Order(db.SortOrderDesc)).Take(1).Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	position := 0
+	if len(skills) > 0 {
+		position = skills[0].Position + 1
+	}
+	param := []db.SkillSetParam{db.Skill.Position.Set(position), db.Skill.Description.SetIfPresent(description)}
+	if categoryID != nil {
+		if err := r.checkCategoryOfContract(ctx, *categoryID, contractID); err != nil {
+			return nil, err
+		}
+		param = append(param, db.Skill.Category.Link(db.SkillCategory.ID.Equals(*categoryID)))
+	}
+	skill, err := r.Prisma.Skill.CreateOne(db.Skill.Name.Set(name), db.Skill.Contract.Link(db.Contract.ID.Equals(contractID)), param...).Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.publishContractChanged(ctx, contractID)
+	return skill, nil
+}
+
+func (r *mutationResolver) DeleteOneSkill(ctx context.Context, id int) (*db.SkillModel, error) {
+	skill, err := r.Prisma.Skill.FindUnique(db.Skill.ID.Equals(id)).Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	deletion, storageKeys, err := r.skillDeletion(ctx, []int{id})
+	if err != nil {
+		return nil, err
+	}
+	if err := r.Prisma.Prisma.Transaction(deletion...).Exec(ctx); err != nil {
+		return nil, err
+	}
+	if err := r.deleteStoredFiles(ctx, storageKeys); err != nil {
+		return nil, err
+	}
+	r.publishContractChanged(ctx, skill.ContractID)
+	return skill, nil
+}
+
+func (r *mutationResolver) UpdateOneSkill(ctx context.Context, skillID int, name *string, description *string) (*db.SkillModel, error) {
+	skill, err := r.Prisma.Skill.FindUnique(db.Skill.ID.Equals(skillID)).Update(db.Skill.Name.SetIfPresent(name), db.Skill.Description.SetIfPresent(description)).Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.publishContractChanged(ctx, skill.ContractID)
+	return skill, nil
+}
+
+func (r *mutationResolver) ReorderSkills(ctx context.Context, contractID int, skillIDs []int) ([]db.SkillModel, error) {
+	skills, err := r.Prisma.Skill.FindMany(db.Skill.ContractID.Equals(contractID)).Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var existing []int
+	for _, skill := range skills {
+		existing = append(existing, skill.ID)
+	}
+	if err := validateOrder(existing, skillIDs); err != nil {
+		return nil, err
+	}
+	var transactions []transaction.Param
+	for position, id := range skillIDs {
+		transactions = append(transactions, r.Prisma.Skill.FindUnique(db.Skill.ID.Equals(id)).Update(db.Skill.Position.Set(position)).Tx())
+	}
+	if err := r.Prisma.Prisma.Transaction(transactions...).Exec(ctx); err != nil {
+		return nil, err
+	}
+	r.publishContractChanged(ctx, contractID)
+	return r.Prisma.Skill.FindMany(db.Skill.ContractID.Equals(contractID)).OrderBy(db.Skill.Position.Order(db.SortOrderAsc)).Exec(ctx)
+}
+
+func (r *mutationResolver) CreateSkillCategory(ctx context.Context, contractID int, name string) (*db.SkillCategoryModel, error) {
+	name, err := validateCategoryName(name)
+	if err != nil {
+		return nil, err
+	}
+	// New categories go after the existing ones
+	categories, err := r.Prisma.SkillCategory.FindMany(db.SkillCategory.ContractID.Equals(contractID)).OrderBy(db.SkillCategory.Position.Order(db.SortOrderDesc)).Take(1).Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	position := 0
+	if len(categories) > 0 {
+		position = categories[0].Position + 1
+	}
+	category, err := r.Prisma.SkillCategory.CreateOne(db.SkillCategory.Contract.Link(db.Contract.ID.Equals(contractID)), db.SkillCategory.Name.Set(name), db.SkillCategory.Position.Set(position)).Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.publishContractChanged(ctx, contractID)
+	return category, nil
+}
+
+func (r *mutationResolver) RenameSkillCategory(ctx context.Context, id int, name string) (*db.SkillCategoryModel, error) {
+	name, err := validateCategoryName(name)
+	if err != nil {
+		return nil, err
+	}
+	category, err := r.Prisma.SkillCategory.FindUnique(db.SkillCategory.ID.Equals(id)).Update(db.SkillCategory.Name.Set(name)).Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.publishContractChanged(ctx, category.ContractID)
+	return category, nil
+}
+
+func (r *mutationResolver) DeleteSkillCategory(ctx context.Context, id int) (*db.SkillCategoryModel, error) {
+	category, err := r.Prisma.SkillCategory.FindUnique(db.SkillCategory.ID.Equals(id)).Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Skills of the category are kept without a category
+	err = r.Prisma.Prisma.Transaction(
+		r.Prisma.Skill.FindMany(db.Skill.CategoryID.Equals(id)).Update(db.Skill.CategoryID.SetOptional(nil)).Tx(),
+		r.Prisma.SkillCategory.FindUnique(db.SkillCategory.ID.Equals(id)).Delete().Tx(),
+	).Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.publishContractChanged(ctx, category.ContractID)
+	return category, nil
+}
+
+func (r *mutationResolver) ReorderSkillCategories(ctx context.Context, contractID int, categoryIDs []int) ([]db.SkillCategoryModel, error) {
+	categories, err := r.Prisma.SkillCategory.FindMany(db.SkillCategory.ContractID.Equals(contractID)).Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var existing []int
+	for _, category := range categories {
+		existing = append(existing, category.ID)
+	}
+	if err := validateOrder(existing, categoryIDs); err != nil {
+		return nil, err
+	}
+	var transactions []transaction.Param
+	for position, id := range categoryIDs {
+		transactions = append(transactions, r.Prisma.SkillCategory.FindUnique(db.SkillCategory.ID.Equals(id)).Update(db.SkillCategory.Position.Set(position)).Tx())
+	}
+	if err := r.Prisma.Prisma.Transaction(transactions...).Exec(ctx); err != nil {
+		return nil, err
+	}
+	r.publishContractChanged(ctx, contractID)
+	return r.Prisma.SkillCategory.FindMany(db.SkillCategory.ContractID.Equals(contractID)).OrderBy(db.SkillCategory.Position.Order(db.SortOrderAsc)).Exec(ctx)
+}
+
+func (r *mutationResolver) SetSkillsCategory(ctx context.Context, skillIDs []int, categoryID *int) ([]db.SkillModel, error) {
+	skills, err := r.Prisma.Skill.FindMany(db.Skill.ID.In(skillIDs)).Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if categoryID != nil {
+		category, err := r.Prisma.SkillCategory.FindUnique(db.SkillCategory.ID.Equals(*categoryID)).Exec(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, skill := range skills {
+			if skill.ContractID != category.ContractID {
+				return nil, fmt.Errorf("the skill %s is not part of the contract of the category %s", skill.Name, category.Name)
+			}
+		}
+	}
+	_, err = r.Prisma.Skill.FindMany(db.Skill.ID.In(skillIDs)).Update(db.Skill.CategoryID.SetOptional(categoryID)).Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	changed := make(map[int]bool)
+	for _, skill := range skills {
+		if !changed[skill.ContractID] {
+			changed[skill.ContractID] = true
+			r.publishContractChanged(ctx, skill.ContractID)
+		}
+	}
+	return r.Prisma.Skill.FindMany(db.Skill.ID.In(skillIDs)).OrderBy(db.Skill.Position.Order(db.SortOrderAsc), db.Skill.ID.Order(db.SortOrderAsc)).Exec(ctx)
+}
+
+func (r *mutationResolver) SetSkillCompetency(ctx context.Context, skillID int, competencyID *int) (*db.SkillModel, error) {
+	if competencyID == nil {
+		return r.Prisma.Skill.FindUnique(db.Skill.ID.Equals(skillID)).Update(db.Skill.Competency.Unlink()).Exec(ctx)
+	}
+	return r.Prisma.Skill.FindUnique(db.Skill.ID.Equals(skillID)).Update(db.Skill.Competency.Link(db.Competency.ID.Equals(*competencyID))).Exec(ctx)
+}
+
+func (r *mutationResolver) CreateCompetencyDomain(ctx context.Context, code string, name string) (*db.CompetencyDomainModel, error) {
+	code, name, err := validateCompetencyText(code, name)
+	if err != nil {
+		return nil, err
+	}
+	// New domains go after the existing ones
+	domains, err := r.Prisma.CompetencyDomain.FindMany().OrderBy(db.CompetencyDomain.Position.Order(db.SortOrderDesc)).Take(1).Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	position := 0
+	if len(domains) > 0 {
+		position = domains[0].Position + 1
+	}
+	return r.Prisma.CompetencyDomain.CreateOne(db.CompetencyDomain.Code.Set(code), db.CompetencyDomain.Name.Set(name), db.CompetencyDomain.Position.Set(position)).Exec(ctx)
+}
+
+func (r *mutationResolver) UpdateCompetencyDomain(ctx context.Context, id int, code *string, name *string) (*db.CompetencyDomainModel, error) {
+	domain, err := r.Prisma.CompetencyDomain.FindUnique(db.CompetencyDomain.ID.Equals(id)).Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	newCode, newName := domain.Code, domain.Name
+	if code != nil {
+		newCode = *code
+	}
+	if name != nil {
+		newName = *name
+	}
+	if newCode, newName, err = validateCompetencyText(newCode, newName); err != nil {
+		return nil, err
+	}
+	return r.Prisma.CompetencyDomain.FindUnique(db.CompetencyDomain.ID.Equals(id)).Update(db.CompetencyDomain.Code.Set(newCode), db.CompetencyDomain.Name.Set(newName)).Exec(ctx)
+}
+
+func (r *mutationResolver) DeleteCompetencyDomain(ctx context.Context, id int) (*db.CompetencyDomainModel, error) {
+	domain, err := r.Prisma.CompetencyDomain.FindUnique(db.CompetencyDomain.ID.Equals(id)).Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Skills targeting a competency of the domain are kept without a competency
+	err = r.Prisma.Prisma.Transaction(
+		r.Prisma.Skill.FindMany(db.Skill.Competency.Where(db.Competency.DomainID.Equals(id))).Update(db.Skill.CompetencyID.SetOptional(nil)).Tx(),
+		r.Prisma.Competency.FindMany(db.Competency.DomainID.Equals(id)).Delete().Tx(),
+		r.Prisma.CompetencyDomain.FindUnique(db.CompetencyDomain.ID.Equals(id)).Delete().Tx(),
+	).Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return domain, nil
+}
+
+func (r *mutationResolver) CreateCompetency(ctx context.Context, domainID int, code string, name string) (*db.CompetencyModel, error) {
+	code, name, err := validateCompetencyText(code, name)
+	if err != nil {
+		return nil, err
+	}
+	// New competencies go after the existing ones of their domain
+	competencies, err := r.Prisma.Competency.FindMany(db.Competency.DomainID.Equals(domainID)).OrderBy(db.Competency.Position.Order(db.SortOrderDesc)).Take(1).Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	position := 0
+	if len(competencies) > 0 {
+		position = competencies[0].Position + 1
+	}
+	return r.Prisma.Competency.CreateOne(db.Competency.Domain.Link(db.CompetencyDomain.ID.Equals(domainID)), db.Competency.Code.Set(code), db.Competency.Name.Set(name), db.Competency.Position.Set(position)).Exec(ctx)
+}
+
+func (r *mutationResolver) UpdateCompetency(ctx context.Context, id int, domainID *int, code *string, name *string) (*db.CompetencyModel, error) {
+	competency, err := r.Prisma.Competency.FindUnique(db.Competency.ID.Equals(id)).Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	newCode, newName := competency.Code, competency.Name
+	if code != nil {
+		newCode = *code
+	}
+	if name != nil {
+		newName = *name
+	}
+	if newCode, newName, err = validateCompetencyText(newCode, newName); err != nil {
+		return nil, err
+	}
+	param := []db.CompetencySetParam{db.Competency.Code.Set(newCode), db.Competency.Name.Set(newName)}
+	if domainID != nil {
+		param = append(param, db.Competency.Domain.Link(db.CompetencyDomain.ID.Equals(*domainID)))
+	}
+	return r.Prisma.Competency.FindUnique(db.Competency.ID.Equals(id)).Update(param...).Exec(ctx)
+}
+
+func (r *mutationResolver) DeleteCompetency(ctx context.Context, id int) (*db.CompetencyModel, error) {
+	competency, err := r.Prisma.Competency.FindUnique(db.Competency.ID.Equals(id)).Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Skills targeting the competency are kept without one
+	err = r.Prisma.Prisma.Transaction(
+		r.Prisma.Skill.FindMany(db.Skill.CompetencyID.Equals(id)).Update(db.Skill.CompetencyID.SetOptional(nil)).Tx(),
+		r.Prisma.Competency.FindUnique(db.Competency.ID.Equals(id)).Delete().Tx(),
+	).Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return competency, nil
+}
+
+func (r *mutationResolver) UpdateOneStudent(ctx context.Context, ownerUsername string, groupIDs []int) (*db.StudentModel, error) {
+	toLink, err := r.Prisma.Group.FindMany(db.Group.ID.In(groupIDs), db.Group.Not(db.Group.Students.Some(db.Student.OwnerID.Equals(ownerUsername)))).Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	toUnLink, err := r.Prisma.Group.FindMany(db.Group.Not(db.Group.ID.In(groupIDs)), db.Group.Students.Some(db.Student.OwnerID.Equals(ownerUsername))).Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var transactions []transaction.Param
+	for _, groupModel := range toUnLink {
+		transactions = append(transactions, r.Prisma.Group.FindUnique(db.Group.ID.Equals(groupModel.ID)).Update(db.Group.Students.Unlink(db.Student.OwnerID.Equals(ownerUsername))).Tx())
+	}
+	for _, groupModel := range toLink {
+		transactions = append(transactions, r.Prisma.Group.FindUnique(db.Group.ID.Equals(groupModel.ID)).Update(db.Group.Students.Link(db.Student.OwnerID.Equals(ownerUsername))).Tx())
+	}
+	err = r.Prisma.Prisma.Transaction(transactions...).Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return r.Prisma.Student.FindUnique(db.Student.OwnerID.Equals(ownerUsername)).Exec(ctx)
+}
+
+func (r *mutationResolver) CreateOneContract(ctx context.Context, end time.Time, name string, hexColor string, start time.Time, skillNames []string, markScaleID *int) (*db.ContractModel, error) {
+	skills := make([]newSkill, 0, len(skillNames))
+	for _, skillName := range skillNames {
+		skills = append(skills, newSkill{name: skillName})
+	}
+	return r.createContract(ctx, name, &hexColor, start, end, markScaleID, nil, skills)
+}
+
+func (r *mutationResolver) DeleteOneContract(ctx context.Context, id int) (*db.ContractModel, error) {
+	skills, err := r.Prisma.Skill.FindMany(db.Skill.ContractID.Equals(id)).Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var skillIDs []int
+	for _, skill := range skills {
+		skillIDs = append(skillIDs, skill.ID)
+	}
+	deletion, storageKeys, err := r.skillDeletion(ctx, skillIDs)
+	if err != nil {
+		return nil, err
+	}
+	deleteCategories := r.Prisma.SkillCategory.FindMany(db.SkillCategory.ContractID.Equals(id)).Delete().Tx()
+	deleteContract := r.Prisma.Contract.FindUnique(db.Contract.ID.Equals(id)).Delete().Tx()
+	if err := r.Prisma.Prisma.Transaction(append(deletion, deleteCategories, deleteContract)...).Exec(ctx); err != nil {
+		return nil, err
+	}
+	if err := r.deleteStoredFiles(ctx, storageKeys); err != nil {
+		return nil, err
+	}
+	r.publishContractChanged(ctx, id)
+	return deleteContract.Result(), nil
+}
+
+func (r *mutationResolver) DuplicateContract(ctx context.Context, id int, newName string, start time.Time, end time.Time, groupIDs []int, hexColor *string) (*db.ContractModel, error) {
+	contract, err := r.Prisma.Contract.FindUnique(db.Contract.ID.Equals(id)).With(db.Contract.Skills.Fetch().OrderBy(db.Skill.Position.Order(db.SortOrderAsc), db.Skill.ID.Order(db.SortOrderAsc)).With(db.Skill.Category.Fetch()), db.Contract.Groups.Fetch()).Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// The copy is given to the same groups unless others are chosen
+	if groupIDs == nil {
+		for _, group := range contract.Groups() {
+			groupIDs = append(groupIDs, group.ID)
+		}
+	}
+	var markScaleID *int
+	if scaleID, ok := contract.MarkScaleID(); ok {
+		markScaleID = &scaleID
+	}
+	return r.createContract(ctx, newName, hexColor, start, end, markScaleID, groupIDs, copiedSkills(contract.Skills()))
+}
+
+func (r *mutationResolver) CreateContractTemplate(ctx context.Context, name string, description *string, skills []model.TemplateSkillInput) (*db.ContractTemplateModel, error) {
+	name, err := r.validateTemplateName(ctx, 0, name)
+	if err != nil {
+		return nil, err
+	}
+	skills, err = validateTemplateSkills(skills)
+	if err != nil {
+		return nil, err
+	}
+	// The template and its skills are created together so a failing skill does not leave an empty template
+	template := r.Prisma.ContractTemplate.CreateOne(db.ContractTemplate.Name.Set(name), db.ContractTemplate.Description.SetIfPresent(description)).Tx()
+	transactions := append([]transaction.Param{template}, r.createTemplateSkills(db.ContractTemplate.Name.Equals(name), skills)...)
+	if err := r.Prisma.Prisma.Transaction(transactions...).Exec(ctx); err != nil {
+		if isUniqueViolation(err) {
+			return nil, templateNameTaken(name)
+		}
+		return nil, err
+	}
+	return template.Result(), nil
+}
+
+func (r *mutationResolver) UpdateContractTemplate(ctx context.Context, id int, name *string, description *string, skills []model.TemplateSkillInput) (*db.ContractTemplateModel, error) {
+	if name != nil {
+		validated, err := r.validateTemplateName(ctx, id, *name)
+		if err != nil {
+			return nil, err
+		}
+		name = &validated
+	}
+	transactions := []transaction.Param{
+		r.Prisma.ContractTemplate.FindUnique(db.ContractTemplate.ID.Equals(id)).Update(db.ContractTemplate.Name.SetIfPresent(name), db.ContractTemplate.Description.SetIfPresent(description)).Tx(),
+	}
+	// Skills are replaced as a whole so their order always matches the given list
+	if skills != nil {
+		var err error
+		if skills, err = validateTemplateSkills(skills); err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, r.Prisma.TemplateSkill.FindMany(db.TemplateSkill.TemplateID.Equals(id)).Delete().Tx())
+		transactions = append(transactions, r.createTemplateSkills(db.ContractTemplate.ID.Equals(id), skills)...)
+	}
+	if err := r.Prisma.Prisma.Transaction(transactions...).Exec(ctx); err != nil {
+		if isUniqueViolation(err) && name != nil {
+			return nil, templateNameTaken(*name)
+		}
+		return nil, err
+	}
+	return r.Prisma.ContractTemplate.FindUnique(db.ContractTemplate.ID.Equals(id)).Exec(ctx)
+}
+
+func (r *mutationResolver) DeleteContractTemplate(ctx context.Context, id int) (*db.ContractTemplateModel, error) {
+	template, err := r.Prisma.ContractTemplate.FindUnique(db.ContractTemplate.ID.Equals(id)).Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = r.Prisma.Prisma.Transaction(
+		r.Prisma.TemplateSkill.FindMany(db.TemplateSkill.TemplateID.Equals(id)).Delete().Tx(),
+		r.Prisma.ContractTemplate.FindUnique(db.ContractTemplate.ID.Equals(id)).Delete().Tx(),
+	).Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return template, nil
+}
+
+func (r *mutationResolver) SaveContractAsTemplate(ctx context.Context, contractID int, name string, description *string) (*db.ContractTemplateModel, error) {
+	contract, err := r.Prisma.Contract.FindUnique(db.Contract.ID.Equals(contractID)).With(db.Contract.Skills.Fetch().OrderBy(db.Skill.Position.Order(db.SortOrderAsc), db.Skill.ID.Order(db.SortOrderAsc)).With(db.Skill.Category.Fetch())).Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var skills []model.TemplateSkillInput
+	for _, skill := range copiedSkills(contract.Skills()) {
+		skills = append(skills, model.TemplateSkillInput{Name: skill.name, Description: skill.description, Category: skill.category})
+	}
+	return r.CreateContractTemplate(ctx, name, description, skills)
+}
+
+func (r *mutationResolver) CreateContractFromTemplate(ctx context.Context, templateID int, name string, start time.Time, end time.Time, groupIDs []int, hexColor *string, markScaleID *int) (*db.ContractModel, error) {
+	template, err := r.Prisma.ContractTemplate.FindUnique(db.ContractTemplate.ID.Equals(templateID)).With(db.ContractTemplate.Skills.Fetch().OrderBy(db.TemplateSkill.Position.Order(db.SortOrderAsc))).Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return r.createContract(ctx, name, hexColor, start, end, markScaleID, groupIDs, templateNewSkills(template.Skills()))
+}
+
+func (r *mutationResolver) ArchiveContract(ctx context.Context, id int) (*db.ContractModel, error) {
+	contract, err := r.Prisma.Contract.FindUnique(db.Contract.ID.Equals(id)).Update(db.Contract.Archived.Set(true)).Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.publishContractChanged(ctx, contract.ID)
+	return contract, nil
+}
+
+func (r *mutationResolver) UnarchiveContract(ctx context.Context, id int) (*db.ContractModel, error) {
+	contract, err := r.Prisma.Contract.FindUnique(db.Contract.ID.Equals(id)).Update(db.Contract.Archived.Set(false)).Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.publishContractChanged(ctx, contract.ID)
+	return contract, nil
+}
+
+func (r *mutationResolver) RolloverSchoolYear(ctx context.Context, clearGroups *bool) (*model.RolloverResult, error) {
+	today := time.Now().Truncate(24 * time.Hour)
+	archive := r.Prisma.Contract.FindMany(db.Contract.Archived.Equals(false), db.Contract.End.Before(today)).Update(db.Contract.Archived.Set(true)).Tx()
+	transactions := []transaction.Param{archive}
+	clearedGroups := 0
+	if clearGroups != nil && *clearGroups {
+		clearing, groupCount, err := r.groupMembershipClearing(ctx)
+		if err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, clearing...)
+		clearedGroups = groupCount
+	}
+	if err := r.Prisma.Prisma.Transaction(transactions...).Exec(ctx); err != nil {
+		return nil, err
+	}
+	return &model.RolloverResult{
+		ArchivedContracts: archive.Result().Count,
+		ClearedGroups:     clearedGroups,
+	}, nil
+}
+
+func (r *mutationResolver) DeleteOneStudent(ctx context.Context, ownerUsername string) (*db.StudentModel, error) {
+	student, err := r.Prisma.Student.FindUnique(db.Student.OwnerID.Equals(ownerUsername)).Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	transactions, storageKeys, err := r.studentDeletion(ctx, ownerUsername)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.Prisma.Prisma.Transaction(transactions...).Exec(ctx); err != nil {
+		return nil, err
+	}
+	if err := r.deleteStoredFiles(ctx, storageKeys); err != nil {
+		return nil, err
+	}
+	return student, nil
+}
+
+func (r *mutationResolver) UpsertOneSkillToStudent(ctx context.Context, studentOwnerUsername string, skillID int, mark model.Mark, comment *string) (*db.StudentSkillModel, error) {
+	if err := r.checkMarkInScale(ctx, skillID, db.Mark(mark)); err != nil {
+		return nil, err
+	}
+	previous, err := r.Prisma.StudentSkill.FindUnique(db.StudentSkill.StudentIDSkillID(db.StudentSkill.StudentID.Equals(studentOwnerUsername), db.StudentSkill.SkillID.Equals(skillID))).Exec(ctx)
+	if err != nil && !errors.Is(err, db.ErrNotFound) {
+		return nil, err
+	}
+	upsert := r.Prisma.StudentSkill.UpsertOne(db.StudentSkill.StudentIDSkillID(db.StudentSkill.StudentID.Equals(studentOwnerUsername), db.StudentSkill.SkillID.Equals(skillID))).Update(db.StudentSkill.Mark.Set(db.Mark(mark))).Create(
+		db.StudentSkill.Mark.Set(db.Mark(mark)),
+		db.StudentSkill.Skill.Link(db.Skill.ID.Equals(skillID)),
+		db.StudentSkill.Student.Link(db.Student.OwnerID.Equals(studentOwnerUsername)),
+	).Tx()
+	transactions := []transaction.Param{upsert}
+	if event, ok := r.markChangeEvent(ctx, previous, studentOwnerUsername, skillID, db.Mark(mark), comment); ok {
+		transactions = append(transactions, event)
+	}
+	if err := r.Prisma.Prisma.Transaction(transactions...).Exec(ctx); err != nil {
+		return nil, err
+	}
+	r.publishStudentSkillChanges(ctx, []studentSkillChange{{StudentUsername: studentOwnerUsername, SkillID: skillID}})
+	return upsert.Result(), nil
+}
+
+func (r *mutationResolver) UpsertStudentSkills(ctx context.Context, inputs []model.StudentSkillInput) ([]model.StudentSkillResult, error) {
+	return r.upsertStudentSkills(ctx, inputs)
+}
+
+func (r *mutationResolver) CreateOneStudent(ctx context.Context, student model.StudentInput, user model.UserInput) (*db.StudentModel, error) {
+	if err := validatePassword(user.Password); err != nil {
+		return nil, err
+	}
+	// Pick the username, teachers can choose it
+	var username string
+	if user.Username != nil {
+		chosen, err := validateUsername(*user.Username)
+		if err != nil {
+			return nil, err
+		}
+		taken, err := r.takenUsernames(ctx, []string{chosen})
+		if err != nil {
+			return nil, err
+		}
+		if taken[chosen] {
+			return nil, usernameTaken(chosen)
+		}
+		username = chosen
+	} else {
+		base := utils.UsernameBase(student.FirstName, student.LastName)
+		if len(base) == 0 {
+			return nil, fmt.Errorf("a username cannot be made from the name of the student, please choose one")
+		}
+		taken, err := r.takenUsernames(ctx, []string{base})
+		if err != nil {
+			return nil, err
+		}
+		username = nextUsername(base, taken)
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	// The user and the student are created together so a failure does not leave an account without a student
+	created := r.Prisma.Student.CreateOne(db.Student.Owner.Link(db.User.Username.Equals(username)), db.Student.FirstName.Set(strings.Title(student.FirstName)), db.Student.LastName.Set(strings.Title(student.LastName))).Tx()
+	err = r.Prisma.Prisma.Transaction(
+		r.Prisma.User.CreateOne(db.User.Username.Set(username), db.User.Password.Set(string(hashedPassword)), db.User.Role.Set(db.RoleSTUDENT)).Tx(),
+		created,
+	).Exec(ctx)
+	// Someone else may have taken the username since it was checked
+	if isUniqueViolation(err) {
+		return nil, usernameTaken(username)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return created.Result(), nil
 }
 
-func (r *mutationResolver) UpdateOneContract(ctx context.Context, contractID int, groupIDs []int) (*db.ContractModel, error) {
-	toLink, err := r.Prisma.Group.FindMany(db.Group.ID.In(groupIDs), db.Group.Not(db.Group.Contracts.Some(db.Contract.ID.Equals(contractID)))).Exec(ctx)
+func (r *mutationResolver) ImportStudents(ctx context.Context, file graphql.Upload, dryRun *bool) (*model.StudentImportResult, error) {
+	records, err := readRoster(file)
 	if err != nil {
 		return nil, err
 	}
-	toUnLink, err := r.Prisma.Group.FindMany(db.Group.Not(db.Group.ID.In(groupIDs)), db.Group.Contracts.Some(db.Contract.ID.Equals(contractID))).Exec(ctx)
+	rows, err := parseRoster(records)
 	if err != nil {
 		return nil, err
 	}
-	var transactions []transaction.Param
-	for _, groupModel := range toUnLink {
-		transactions = append(transactions, r.Prisma.Group.FindUnique(db.Group.ID.Equals(groupModel.ID)).Update(db.Group.Contracts.Unlink(db.Contract.ID.Equals(contractID))).Tx())
+	return r.importStudents(ctx, rows, dryRun != nil && *dryRun)
+}
+
+func (r *mutationResolver) CreateOneTeacher(ctx context.Context, username string, password string, firstName string, lastName string) (*db.TeacherModel, error) {
+	if err := validatePassword(password); err != nil {
+		return nil, err
 	}
-	for _, groupModel := range toLink {
-		transactions = append(transactions, r.Prisma.Group.FindUnique(db.Group.ID.Equals(groupModel.ID)).Update(db.Group.Contracts.Link(db.Contract.ID.Equals(contractID))).Tx())
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
 	}
-	err = r.Prisma.Prisma.Transaction(transactions...).Exec(ctx)
+	createdUser, err := r.Prisma.User.CreateOne(db.User.Username.Set(username), db.User.Password.Set(string(hashedPassword)), db.User.Role.Set(db.RoleTEACHER)).Exec(ctx)
 	if err != nil {
 		return nil, err
 	}
-	return r.Prisma.Contract.FindUnique(db.Contract.ID.Equals(contractID)).Exec(ctx)
+	return r.Prisma.Teacher.CreateOne(db.Teacher.Owner.Link(db.User.Username.Equals(createdUser.Username)), db.Teacher.FirstName.Set(firstName), db.Teacher.LastName.Set(lastName)).Exec(ctx)
 }
 
-func (r *mutationResolver) CreateOneSkill(ctx context.Context, name string, contractID int) (*db.SkillModel, error) {
-	return r.Prisma.Skill.CreateOne(db.Skill.Name.Set(name), db.Skill.Contract.Link(db.Contract.ID.Equals(contractID))).Exec(ctx)
+type studentAndSkill struct {
+	studentOwnerUsername string
+	skillID              int
 }
 
-func (r *mutationResolver) DeleteOneSkill(ctx context.Context, id int) (*db.SkillModel, error) {
-	return r.Prisma.Skill.FindUnique(db.Skill.ID.Equals(id)).Delete().Exec(ctx)
+func (r *mutationResolver) GenerateSpreadsheet(ctx context.Context, contractIDs []int, groupIDs []int, period *model.DateRange, archived *bool, sheetPerGroup *bool) (string, error) {
+	return r.createExport(ctx, contractIDs, groupIDs, period, archived, sheetPerGroup != nil && *sheetPerGroup)
 }
 
-func (r *mutationResolver) UpdateOneSkill(ctx context.Context, skillID int, name *string) (*db.SkillModel, error) {
-	return r.Prisma.Skill.FindUnique(db.Skill.ID.Equals(skillID)).Update(db.Skill.Name.SetIfPresent(name)).Exec(ctx)
+func (r *mutationResolver) GenerateStudentReport(ctx context.Context, studentUsername string) (string, error) {
+	return r.createStudentReport(ctx, studentUsername)
 }
 
-func (r *mutationResolver) UpdateOneStudent(ctx context.Context, ownerUsername string, groupIDs []int) (*db.StudentModel, error) {
-	toLink, err := r.Prisma.Group.FindMany(db.Group.ID.In(groupIDs), db.Group.Not(db.Group.Students.Some(db.Student.OwnerID.Equals(ownerUsername)))).Exec(ctx)
-	if err != nil {
+func (r *mutationResolver) GenerateGroupReports(ctx context.Context, groupID int) (string, error) {
+	return r.createGroupReports(ctx, groupID)
+}
+
+func (r *mutationResolver) CreateMarkScale(ctx context.Context, name string, levels []model.MarkScaleLevelInput) (*db.MarkScaleModel, error) {
+	if err := validateMarkScaleLevels(levels); err != nil {
 		return nil, err
 	}
-	toUnLink, err := r.Prisma.Group.FindMany(db.Group.Not(db.Group.ID.In(groupIDs)), db.Group.Students.Some(db.Student.OwnerID.Equals(ownerUsername))).Exec(ctx)
-	if err != nil {
+	// The scale and its levels are created together so a failing level does not leave an empty scale
+	markScale := r.Prisma.MarkScale.CreateOne(db.MarkScale.Name.Set(name)).Tx()
+	transactions := append([]transaction.Param{markScale}, r.createMarkScaleLevels(db.MarkScale.Name.Equals(name), levels)...)
+	if err := r.Prisma.Prisma.Transaction(transactions...).Exec(ctx); err != nil {
 		return nil, err
 	}
-	var transactions []transaction.Param
-	for _, groupModel := range toUnLink {
-		transactions = append(transactions, r.Prisma.Group.FindUnique(db.Group.ID.Equals(groupModel.ID)).Update(db.Group.Students.Unlink(db.Student.OwnerID.Equals(ownerUsername))).Tx())
+	return markScale.Result(), nil
+}
+
+func (r *mutationResolver) UpdateMarkScale(ctx context.Context, id int, name *string, levels []model.MarkScaleLevelInput) (*db.MarkScaleModel, error) {
+	transactions := []transaction.Param{
+		r.Prisma.MarkScale.FindUnique(db.MarkScale.ID.Equals(id)).Update(db.MarkScale.Name.SetIfPresent(name)).Tx(),
 	}
-	for _, groupModel := range toLink {
-		transactions = append(transactions, r.Prisma.Group.FindUnique(db.Group.ID.Equals(groupModel.ID)).Update(db.Group.Students.Link(db.Student.OwnerID.Equals(ownerUsername))).Tx())
+	// Levels are replaced as a whole so their order always matches the given list
+	if levels != nil {
+		if err := validateMarkScaleLevels(levels); err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, r.Prisma.MarkScaleLevel.FindMany(db.MarkScaleLevel.ScaleID.Equals(id)).Delete().Tx())
+		transactions = append(transactions, r.createMarkScaleLevels(db.MarkScale.ID.Equals(id), levels)...)
 	}
-	err = r.Prisma.Prisma.Transaction(transactions...).Exec(ctx)
-	if err != nil {
+	if err := r.Prisma.Prisma.Transaction(transactions...).Exec(ctx); err != nil {
 		return nil, err
 	}
-	return r.Prisma.Student.FindUnique(db.Student.OwnerID.Equals(ownerUsername)).Exec(ctx)
+	return r.Prisma.MarkScale.FindUnique(db.MarkScale.ID.Equals(id)).Exec(ctx)
 }
 
-func (r *mutationResolver) CreateOneContract(ctx context.Context, end string, name string, hexColor string, start string, skillNames []string) (*db.ContractModel, error) {
-	startTime, err := time.Parse("2006-01-02", start)
-	if err != nil {
-		return nil, err
-	}
-	endTime, err := time.Parse("2006-01-02", end)
+func (r *mutationResolver) DeleteMarkScale(ctx context.Context, id int) (*db.MarkScaleModel, error) {
+	markScale, err := r.Prisma.MarkScale.FindUnique(db.MarkScale.ID.Equals(id)).Exec(ctx)
 	if err != nil {
 		return nil, err
 	}
-
-	contract, err := r.Prisma.Contract.CreateOne(
-		db.Contract.End.Set(endTime),
-		db.Contract.Name.Set(name),
-		db.Contract.HexColor.Set(hexColor),
-		db.Contract.Start.Set(startTime),
+	// Contracts using the scale fall back to the default marks
+	err = r.Prisma.Prisma.Transaction(
+		r.Prisma.Contract.FindMany(db.Contract.MarkScaleID.Equals(id)).Update(db.Contract.MarkScaleID.SetOptional(nil)).Tx(),
+		r.Prisma.MarkScaleLevel.FindMany(db.MarkScaleLevel.ScaleID.Equals(id)).Delete().Tx(),
+		r.Prisma.MarkScale.FindUnique(db.MarkScale.ID.Equals(id)).Delete().Tx(),
 	).Exec(ctx)
 	if err != nil {
 		return nil, err
 	}
+	return markScale, nil
+}
 
-	var skillsTransactions []transaction.Param
-	for _, skillName := range skillNames {
-		skillsTransactions = append(skillsTransactions, r.Prisma.Skill.CreateOne(db.Skill.Name.Set(skillName), db.Skill.Contract.Link(db.Contract.ID.Equals(contract.ID))).Tx())
+func (r *mutationResolver) SetContractMarkScale(ctx context.Context, contractID int, markScaleID *int) (*db.ContractModel, error) {
+	update := db.Contract.MarkScale.Unlink()
+	if markScaleID != nil {
+		update = db.Contract.MarkScale.Link(db.MarkScale.ID.Equals(*markScaleID))
 	}
-	if err := r.Prisma.Prisma.Transaction(skillsTransactions...).Exec(ctx); err != nil {
+	contract, err := r.Prisma.Contract.FindUnique(db.Contract.ID.Equals(contractID)).Update(update).Exec(ctx)
+	if err != nil {
 		return nil, err
 	}
+	r.publishContractChanged(ctx, contract.ID)
 	return contract, nil
 }
 
-func (r *mutationResolver) DeleteOneContract(ctx context.Context, id int) (*db.ContractModel, error) {
-	err := r.Prisma.Prisma.Transaction(r.Prisma.StudentSkill.FindMany(db.StudentSkill.Skill.Where(db.Skill.ContractID.Equals(id))).Delete().Tx(), r.Prisma.Skill.FindMany(db.Skill.ContractID.Equals(id)).Delete().Tx()).Exec(ctx)
+func (r *mutationResolver) AddStudentSkillComment(ctx context.Context, studentUsername string, skillID int, body string, parentID *int) (*db.StudentSkillCommentModel, error) {
+	body, err := validateCommentBody(body)
 	if err != nil {
 		return nil, err
 	}
-	return r.Prisma.Contract.FindUnique(db.Contract.ID.Equals(id)).Delete().Exec(ctx)
+	if err := r.authorizeStudentSkill(ctx, studentUsername, skillID); err != nil {
+		return nil, err
+	}
+	var param []db.StudentSkillCommentSetParam
+	if parentID != nil {
+		rootID, err := r.threadRootID(ctx, *parentID, studentUsername, skillID)
+		if err != nil {
+			return nil, err
+		}
+		param = append(param, db.StudentSkillComment.Parent.Link(db.StudentSkillComment.ID.Equals(rootID)))
+	}
+	return r.Prisma.StudentSkillComment.CreateOne(
+		db.StudentSkillComment.Skill.Link(db.Skill.ID.Equals(skillID)),
+		db.StudentSkillComment.Student.Link(db.Student.OwnerID.Equals(studentUsername)),
+		db.StudentSkillComment.Author.Link(db.User.Username.Equals(auth.ForContext(ctx).Username)),
+		db.StudentSkillComment.Body.Set(body),
+		param...,
+	).Exec(ctx)
 }
 
-func (r *mutationResolver) DeleteOneStudent(ctx context.Context, ownerUsername string) (*db.StudentModel, error) {
-	//Delete the student
-	student, err := r.Prisma.Student.FindUnique(db.Student.OwnerID.Equals(ownerUsername)).Delete().Exec(ctx)
+func (r *mutationResolver) EditStudentSkillComment(ctx context.Context, id int, body string) (*db.StudentSkillCommentModel, error) {
+	body, err := validateCommentBody(body)
 	if err != nil {
 		return nil, err
 	}
-	//Delete the user
-	_, err = r.Prisma.User.FindUnique(db.User.Username.Equals(ownerUsername)).Delete().Exec(ctx)
-	if err != nil {
+	if _, err := r.findOwnComment(ctx, id); err != nil {
 		return nil, err
 	}
-	return student, nil
-}
-
-func (r *mutationResolver) UpsertOneSkillToStudent(ctx context.Context, studentOwnerUsername string, skillID int, mark model.Mark) (*db.StudentSkillModel, error) {
-	return r.Prisma.StudentSkill.UpsertOne(db.StudentSkill.StudentIDSkillID(db.StudentSkill.StudentID.Equals(studentOwnerUsername), db.StudentSkill.SkillID.Equals(skillID))).Update(db.StudentSkill.Mark.Set(db.Mark(mark))).Create(
-		db.StudentSkill.Mark.Set(db.Mark(mark)),
-		db.StudentSkill.Skill.Link(db.Skill.ID.Equals(skillID)),
-		db.StudentSkill.Student.Link(db.Student.OwnerID.Equals(studentOwnerUsername)),
-	).Exec(ctx)
+	return r.Prisma.StudentSkillComment.FindUnique(db.StudentSkillComment.ID.Equals(id)).Update(db.StudentSkillComment.Body.Set(body)).Exec(ctx)
 }
 
-func (r *mutationResolver) CreateOneStudent(ctx context.Context, student model.StudentInput, user model.UserInput) (*db.StudentModel, error) {
-	// Create the user
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+func (r *mutationResolver) DeleteStudentSkillComment(ctx context.Context, id int) (*db.StudentSkillCommentModel, error) {
+	comment, err := r.findOwnComment(ctx, id)
 	if err != nil {
 		return nil, err
 	}
-	username := strings.ToLower(string(student.FirstName[0]) + student.LastName)
-
-	createdUser, err := r.Prisma.User.CreateOne(db.User.Username.Set(username), db.User.Password.Set(string(hashedPassword)), db.User.Role.Set(db.RoleSTUDENT)).Exec(ctx)
+	// Deleting the first comment of a thread deletes its replies as well
+	err = r.Prisma.Prisma.Transaction(
+		r.Prisma.StudentSkillComment.FindMany(db.StudentSkillComment.ParentID.Equals(id)).Delete().Tx(),
+		r.Prisma.StudentSkillComment.FindUnique(db.StudentSkillComment.ID.Equals(id)).Delete().Tx(),
+	).Exec(ctx)
 	if err != nil {
 		return nil, err
 	}
-	// Create the associated student
-	return r.Prisma.Student.CreateOne(db.Student.Owner.Link(db.User.Username.Equals(createdUser.Username)), db.Student.FirstName.Set(strings.Title(student.FirstName)), db.Student.LastName.Set(strings.Title(student.LastName))).Exec(ctx)
+	return comment, nil
 }
 
-func (r *mutationResolver) CreateOneTeacher(ctx context.Context, username string, password string, firstName string, lastName string) (*db.TeacherModel, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+func (r *mutationResolver) SelfAssessSkill(ctx context.Context, skillID int, mark model.Mark, comment *string) (*db.SelfAssessmentModel, error) {
+	if mark == model.MarkTodo {
+		return nil, fmt.Errorf("a self-assessment needs a mark")
+	}
+	skill, err := r.Prisma.Skill.FindUnique(db.Skill.ID.Equals(skillID)).Exec(ctx)
 	if err != nil {
 		return nil, err
 	}
-	createdUser, err := r.Prisma.User.CreateOne(db.User.Username.Set(username), db.User.Password.Set(string(hashedPassword)), db.User.Role.Set(db.RoleTEACHER)).Exec(ctx)
-	if err != nil {
+	if err := r.authorizeContract(ctx, skill.ContractID); err != nil {
 		return nil, err
 	}
-	return r.Prisma.Teacher.CreateOne(db.Teacher.Owner.Link(db.User.Username.Equals(createdUser.Username)), db.Teacher.FirstName.Set(firstName), db.Teacher.LastName.Set(lastName)).Exec(ctx)
+	if err := r.checkMarkInScale(ctx, skillID, db.Mark(mark)); err != nil {
+		return nil, err
+	}
+	username := auth.ForContext(ctx).Username
+	return r.Prisma.SelfAssessment.UpsertOne(db.SelfAssessment.StudentIDSkillID(db.SelfAssessment.StudentID.Equals(username), db.SelfAssessment.SkillID.Equals(skillID))).Update(
+		db.SelfAssessment.Mark.Set(db.Mark(mark)),
+		db.SelfAssessment.Comment.SetOptional(comment),
+	).Create(
+		db.SelfAssessment.Skill.Link(db.Skill.ID.Equals(skillID)),
+		db.SelfAssessment.Student.Link(db.Student.OwnerID.Equals(username)),
+		db.SelfAssessment.Mark.Set(db.Mark(mark)),
+		db.SelfAssessment.Comment.SetOptional(comment),
+	).Exec(ctx)
 }
 
-type studentAndSkill struct {
-	studentOwnerUsername string
-	skillID              int
+func (r *mutationResolver) UploadAttachment(ctx context.Context, studentUsername string, skillID int, file graphql.Upload) (*db.AttachmentModel, error) {
+	if err := r.authorizeStudentSkill(ctx, studentUsername, skillID); err != nil {
+		return nil, err
+	}
+	return r.storeAttachment(ctx, studentUsername, skillID, file)
 }
 
-func (r *mutationResolver) GenerateSpreadsheet(ctx context.Context) (string, error) {
-	f := excelize.NewFile()
-
-	contracts, err := r.Prisma.Contract.FindMany().With(db.Contract.Skills.Fetch().With(db.Skill.StudentSkills.Fetch().With(db.StudentSkill.Student.Fetch())), db.Contract.Groups.Fetch().With(db.Group.Students.Fetch())).Exec(ctx)
+func (r *mutationResolver) DeleteAttachment(ctx context.Context, id int) (*db.AttachmentModel, error) {
+	attachment, err := r.Prisma.Attachment.FindUnique(db.Attachment.ID.Equals(id)).Exec(ctx)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-
-	for _, contract := range contracts {
-		f.NewSheet(contract.Name)
-		f.DeleteSheet(f.GetSheetName(0))
-		students := make(map[string]db.StudentModel)
-		for _, groupModel := range contract.Groups() {
-			for _, studentModel := range groupModel.Students() {
-				students[studentModel.OwnerID] = studentModel
-			}
-		}
-		i := 2
-		f.SetCellValue(contract.Name, "A1", "Élèves")
-		for _, studentModel := range students {
-			axis, err := excelize.CoordinatesToCellName(1, i)
-			if err != nil {
-				return "", err
-			}
-			err = f.SetCellValue(contract.Name, axis, studentModel.FirstName+" "+studentModel.LastName)
-			if err != nil {
-				return "", err
-			}
-			i++
-		}
-		i = 2
-		for skillIndex, skillModel := range contract.Skills() {
-			axis, err := excelize.CoordinatesToCellName(skillIndex+2, 1)
-			if err != nil {
-				return "", err
-			}
-			err = f.SetCellValue(contract.Name, axis, skillModel.Name)
-			if err != nil {
-				return "", err
-			}
-			studentToStudentSkill := make(map[string]db.StudentSkillModel)
-
-			for _, studentSkillModel := range skillModel.StudentSkills() {
-				studentToStudentSkill[studentSkillModel.StudentID] = studentSkillModel
-			}
-			for s := range students {
-				studentSkillModel, exists := studentToStudentSkill[s]
-				axis, err := excelize.CoordinatesToCellName(skillIndex+2, i)
-				var markData utils.MarkData
-				if exists {
-					markData = utils.GetMarkData(studentSkillModel.Mark)
-				} else {
-					markData = utils.GetMarkData(db.MarkTODO)
-				}
-				err = f.SetCellValue(contract.Name, axis, markData.Text)
-				if err != nil {
-					return "", err
-				}
-				style, err := f.NewStyle(markData.Style)
-				err = f.SetCellStyle(contract.Name, axis, axis, style)
-				if err != nil {
-					return "", err
-				}
-				i++
-			}
-			i = 2
-
-		}
-
+	// Teachers can remove any file, others only the ones they uploaded
+	user := auth.ForContext(ctx)
+	if attachment.UploaderID != user.Username && !auth.HasRole(user, db.RoleTEACHER) {
+		return nil, auth.Forbidden()
 	}
-	buffer, err := f.WriteToBuffer()
+	attachment, err = r.Prisma.Attachment.FindUnique(db.Attachment.ID.Equals(id)).Delete().Exec(ctx)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	toString := b64.StdEncoding.EncodeToString(buffer.Bytes())
-	return "data:application/vnd.openxmlformats-officedocument.spreadsheetml.sheet;base64," + toString, err
+	if err := r.Storage.Delete(ctx, attachment.StorageKey); err != nil {
+		return nil, err
+	}
+	return attachment, nil
 }
 
-func (r *queryResolver) Contracts(ctx context.Context, groups *model.FilterGroup) ([]db.ContractModel, error) {
-	var params []db.ContractWhereParam
+func (r *queryResolver) Contracts(ctx context.Context, groups *model.FilterGroup, filter *model.ContractFilter, orderBy *model.ContractOrderBy, first *int, after *string, last *int, before *string) (*model.ContractConnection, error) {
+	p, err := newPage(first, after, last, before)
+	if err != nil {
+		return nil, err
+	}
+	params, err := contractWhere(filter)
+	if err != nil {
+		return nil, err
+	}
 	if groups != nil {
 		params = append(params, db.Contract.Groups.Some(db.Group.ID.In(groups.IdsIn)))
 	}
-	return r.Prisma.Contract.FindMany(params...).Exec(ctx)
+	if me, restricted := restrictedStudent(ctx); restricted {
+		// Students cannot open archived contracts, so they are not listed either
+		params = append(params, studentContracts(me), db.Contract.Archived.Equals(false))
+	}
+	return r.contractPage(ctx, p, orderBy, params...)
 }
 
-func (r *queryResolver) Groups(ctx context.Context) ([]db.GroupModel, error) {
-	return r.Prisma.Group.FindMany().Exec(ctx)
+func (r *queryResolver) Groups(ctx context.Context, first *int, after *string, last *int, before *string) (*model.GroupConnection, error) {
+	p, err := newPage(first, after, last, before)
+	if err != nil {
+		return nil, err
+	}
+	var params []db.GroupWhereParam
+	if me, restricted := restrictedStudent(ctx); restricted {
+		params = append(params, db.Group.Students.Some(db.Student.OwnerID.Equals(me)))
+	}
+	return r.groupPage(ctx, p, params...)
 }
 
 func (r *queryResolver) Student(ctx context.Context, ownerUsername string) (*db.StudentModel, error) {
+	if err := r.authorizeStudent(ctx, ownerUsername); err != nil {
+		return nil, err
+	}
 	return r.Prisma.Student.FindUnique(db.Student.OwnerID.Equals(ownerUsername)).Exec(ctx)
 }
 
 func (r *queryResolver) Contract(ctx context.Context, id int) (*db.ContractModel, error) {
+	if err := r.authorizeContract(ctx, id); err != nil {
+		return nil, err
+	}
 	return r.Prisma.Contract.FindUnique(db.Contract.ID.Equals(id)).Exec(ctx)
 }
 
-func (r *queryResolver) Students(ctx context.Context, contractID *int) ([]db.StudentModel, error) {
-	var param []db.StudentWhereParam
+func (r *queryResolver) Students(ctx context.Context, contractID *int, filter *model.StudentFilter, orderBy *model.StudentOrderBy, first *int, after *string, last *int, before *string) (*model.StudentConnection, error) {
+	p, err := newPage(first, after, last, before)
+	if err != nil {
+		return nil, err
+	}
+	param, err := studentWhere(filter)
+	if err != nil {
+		return nil, err
+	}
 	if contractID != nil {
 		param = append(param, db.Student.Groups.Some(db.Group.Contracts.Some(db.Contract.ID.EqualsIfPresent(contractID))))
 	}
-	return r.Prisma.Student.FindMany(param...).Exec(ctx)
+	return r.studentPage(ctx, p, orderBy, param...)
 }
 
-func (r *queryResolver) Teachers(ctx context.Context) ([]db.TeacherModel, error) {
-	return r.Prisma.Teacher.FindMany().Exec(ctx)
+func (r *queryResolver) Teachers(ctx context.Context, first *int, after *string, last *int, before *string) (*model.TeacherConnection, error) {
+	p, err := newPage(first, after, last, before)
+	if err != nil {
+		return nil, err
+	}
+	return r.teacherPage(ctx, p)
 }
 
 func (r *queryResolver) Me(ctx context.Context) (*model.User, error) {
@@ -344,37 +1231,164 @@ func (r *queryResolver) Me(ctx context.Context) (*model.User, error) {
 	}, nil
 }
 
-func (r *queryResolver) StudentSkills(ctx context.Context, studentUsername string, contractID *int) ([]db.StudentSkillModel, error) {
+func (r *queryResolver) StudentSkills(ctx context.Context, studentUsername string, contractID *int, filter *model.StudentSkillFilter, orderBy *model.StudentSkillOrderBy) ([]db.StudentSkillModel, error) {
+	studentSkillParams, err := studentSkillWhere(filter)
+	if err != nil {
+		return nil, err
+	}
+	var skillParams []db.SkillWhereParam
+	if filter != nil {
+		if skillParams, err = skillWhere(filter.Skill); err != nil {
+			return nil, err
+		}
+	}
 	// Find existing studentSkills
-	studentSkills, err := r.Prisma.StudentSkill.FindMany(db.StudentSkill.StudentID.Equals(studentUsername), db.StudentSkill.Skill.Where(db.Skill.ContractID.EqualsIfPresent(contractID))).Exec(ctx)
+	studentSkills, err := r.Prisma.StudentSkill.FindMany(append(studentSkillParams, db.StudentSkill.StudentID.Equals(studentUsername), db.StudentSkill.Skill.Where(db.Skill.ContractID.EqualsIfPresent(contractID)))...).Exec(ctx)
 	if err != nil {
 		return nil, err
 	}
 	// Find to do studentSkills
-	todoSkills, err := r.Prisma.Skill.FindMany(db.Skill.StudentSkills.Every(db.StudentSkill.Not(db.StudentSkill.StudentID.Equals(studentUsername))), db.Skill.Contract.Where(db.Contract.ID.EqualsIfPresent(contractID), db.Contract.Groups.Some(db.Group.Students.Some(db.Student.OwnerID.Equals(studentUsername))))).Exec(ctx)
+	if matchesMarks(filter, db.MarkTODO) {
+		todoSkills, err := r.Prisma.Skill.FindMany(append(skillParams, db.Skill.StudentSkills.Every(db.StudentSkill.Not(db.StudentSkill.StudentID.Equals(studentUsername))), db.Skill.Contract.Where(db.Contract.ID.EqualsIfPresent(contractID), db.Contract.Groups.Some(db.Group.Students.Some(db.Student.OwnerID.Equals(studentUsername)))))...).Exec(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, skill := range todoSkills {
+			studentSkills = append(studentSkills, db.StudentSkillModel{
+				InnerStudentSkill: db.InnerStudentSkill{
+					SkillID:   skill.ID,
+					StudentID: studentUsername,
+					Mark:      db.MarkTODO,
+				},
+			})
+		}
+	}
+	sortStudentSkills(studentSkills, orderBy)
+	return studentSkills, nil
+}
+
+func (r *queryResolver) Sessions(ctx context.Context, username string) ([]db.SessionModel, error) {
+	if err := r.authorizeAccount(ctx, username); err != nil {
+		return nil, err
+	}
+	return r.Prisma.Session.FindMany(db.Session.OwnerID.Equals(username)).OrderBy(db.Session.CreatedAt.Order(db.SortOrderDesc)).Exec(ctx)
+}
+
+func (r *queryResolver) MarkScales(ctx context.Context) ([]db.MarkScaleModel, error) {
+	return r.Prisma.MarkScale.FindMany().Exec(ctx)
+}
+
+func (r *queryResolver) ContractTemplates(ctx context.Context) ([]db.ContractTemplateModel, error) {
+	return r.Prisma.ContractTemplate.FindMany().OrderBy(db.ContractTemplate.Name.Order(db.SortOrderAsc)).Exec(ctx)
+}
+
+func (r *queryResolver) CompetencyDomains(ctx context.Context) ([]db.CompetencyDomainModel, error) {
+	return r.Prisma.CompetencyDomain.FindMany().OrderBy(db.CompetencyDomain.Position.Order(db.SortOrderAsc), db.CompetencyDomain.ID.Order(db.SortOrderAsc)).Exec(ctx)
+}
+
+func (r *queryResolver) StudentCompetencies(ctx context.Context, studentUsername string, period *model.DateRange) ([]model.CompetencyProgress, error) {
+	if err := r.authorizeStudent(ctx, studentUsername); err != nil {
+		return nil, err
+	}
+	// The contracts of the current year unless a period is given
+	if period == nil {
+		return r.studentCompetencyProgress(ctx, studentUsername, db.Contract.Archived.Equals(false))
+	}
+	from, to, err := dateRange(period)
 	if err != nil {
 		return nil, err
 	}
-	for _, skill := range todoSkills {
-		studentSkills = append(studentSkills, db.StudentSkillModel{
-			InnerStudentSkill: db.InnerStudentSkill{
-				SkillID:   skill.ID,
-				StudentID: studentUsername,
-				Mark:      db.MarkTODO,
-			},
+	return r.studentCompetencyProgress(ctx, studentUsername, db.Contract.Start.BeforeEqualsIfPresent(to), db.Contract.End.AfterEqualsIfPresent(from))
+}
+
+func (r *queryResolver) RecentStudentSkillEvents(ctx context.Context, groupID int, limit *int) ([]db.StudentSkillEventModel, error) {
+	return r.Prisma.StudentSkillEvent.FindMany(db.StudentSkillEvent.StudentSkill.Where(db.StudentSkill.Student.Where(db.Student.Groups.Some(db.Group.ID.Equals(groupID))))).OrderBy(db.StudentSkillEvent.CreatedAt.Order(db.SortOrderDesc)).Take(recentEventsLimit(limit)).Exec(ctx)
+}
+
+func (r *queryResolver) SelfAssessmentDivergences(ctx context.Context, contractID int) ([]model.SelfAssessmentDivergence, error) {
+	selfAssessments, err := r.Prisma.SelfAssessment.FindMany(db.SelfAssessment.Skill.Where(db.Skill.ContractID.Equals(contractID))).With(db.SelfAssessment.Skill.Fetch(), db.SelfAssessment.Student.Fetch()).OrderBy(db.SelfAssessment.StudentID.Order(db.SortOrderAsc)).Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	studentSkills, err := r.Prisma.StudentSkill.FindMany(db.StudentSkill.Skill.Where(db.Skill.ContractID.Equals(contractID))).Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	teacherMarks := make(map[studentAndSkill]db.Mark)
+	for _, studentSkill := range studentSkills {
+		teacherMarks[studentAndSkill{studentOwnerUsername: studentSkill.StudentID, skillID: studentSkill.SkillID}] = studentSkill.Mark
+	}
+	divergences := []model.SelfAssessmentDivergence{}
+	for i := range selfAssessments {
+		selfAssessment := &selfAssessments[i]
+		// Skills the teacher has not marked yet are still to do
+		teacherMark, ok := teacherMarks[studentAndSkill{studentOwnerUsername: selfAssessment.StudentID, skillID: selfAssessment.SkillID}]
+		if !ok {
+			teacherMark = db.MarkTODO
+		}
+		if teacherMark == selfAssessment.Mark {
+			continue
+		}
+		divergences = append(divergences, model.SelfAssessmentDivergence{
+			Student:        selfAssessment.Student(),
+			Skill:          selfAssessment.Skill(),
+			TeacherMark:    model.Mark(teacherMark),
+			SelfAssessment: selfAssessment,
 		})
 	}
-	return studentSkills, nil
+	return divergences, nil
+}
+
+func (r *selfAssessmentResolver) Mark(ctx context.Context, obj *db.SelfAssessmentModel) (model.Mark, error) {
+	return model.Mark(obj.Mark), nil
+}
+
+func (r *selfAssessmentResolver) Comment(ctx context.Context, obj *db.SelfAssessmentModel) (*string, error) {
+	comment, ok := obj.Comment()
+	if !ok {
+		return nil, nil
+	}
+	return &comment, nil
+}
+
+func (r *sessionResolver) OwnerUsername(ctx context.Context, obj *db.SessionModel) (string, error) {
+	return obj.OwnerID, nil
+}
+
+func (r *skillResolver) Description(ctx context.Context, obj *db.SkillModel) (*string, error) {
+	return optionalString(obj.Description()), nil
+}
+
+func (r *skillResolver) Category(ctx context.Context, obj *db.SkillModel) (*db.SkillCategoryModel, error) {
+	categoryID, ok := obj.CategoryID()
+	if !ok {
+		return nil, nil
+	}
+	return r.Prisma.SkillCategory.FindUnique(db.SkillCategory.ID.Equals(categoryID)).Exec(ctx)
+}
+
+func (r *skillResolver) Competency(ctx context.Context, obj *db.SkillModel) (*db.CompetencyModel, error) {
+	competencyID, ok := obj.CompetencyID()
+	if !ok {
+		return nil, nil
+	}
+	return r.Prisma.Competency.FindUnique(db.Competency.ID.Equals(competencyID)).Exec(ctx)
 }
 
 func (r *skillResolver) StudentSkills(ctx context.Context, obj *db.SkillModel) ([]db.StudentSkillModel, error) {
+	studentSkillParams := []db.StudentSkillWhereParam{db.StudentSkill.SkillID.Equals(obj.ID)}
+	studentParams := []db.StudentWhereParam{db.Student.Groups.Some(db.Group.Contracts.Some(db.Contract.ID.Equals(obj.ContractID))), db.Student.StudentSkills.Some(db.StudentSkill.Not(db.StudentSkill.SkillID.Equals(obj.ID)))}
+	if me, restricted := restrictedStudent(ctx); restricted {
+		studentSkillParams = append(studentSkillParams, db.StudentSkill.StudentID.Equals(me))
+		studentParams = append(studentParams, db.Student.OwnerID.Equals(me))
+	}
 	// Find existing studentSkills
-	studentSkills, err := r.Prisma.StudentSkill.FindMany(db.StudentSkill.SkillID.Equals(obj.ID)).Exec(ctx)
+	studentSkills, err := r.Prisma.StudentSkill.FindMany(studentSkillParams...).Exec(ctx)
 	if err != nil {
 		return nil, err
 	}
 	// Find to do studentSkills
-	todoStudents, err := r.Prisma.Student.FindMany(db.Student.Groups.Some(db.Group.Contracts.Some(db.Contract.ID.Equals(obj.ContractID))), db.Student.StudentSkills.Some(db.StudentSkill.Not(db.StudentSkill.SkillID.Equals(obj.ID)))).Exec(ctx)
+	todoStudents, err := r.Prisma.Student.FindMany(studentParams...).Exec(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -390,6 +1404,10 @@ func (r *skillResolver) StudentSkills(ctx context.Context, obj *db.SkillModel) (
 	return studentSkills, nil
 }
 
+func (r *skillCategoryResolver) Skills(ctx context.Context, obj *db.SkillCategoryModel) ([]db.SkillModel, error) {
+	return r.Prisma.Skill.FindMany(db.Skill.CategoryID.Equals(obj.ID)).OrderBy(db.Skill.Position.Order(db.SortOrderAsc), db.Skill.ID.Order(db.SortOrderAsc)).Exec(ctx)
+}
+
 func (r *studentResolver) Owner(ctx context.Context, obj *db.StudentModel) (*model.User, error) {
 	user, err := r.Prisma.User.FindUnique(db.User.Username.Equals(obj.OwnerID)).Exec(ctx)
 	if err != nil {
@@ -406,13 +1424,23 @@ func (r *studentResolver) OwnerUsername(ctx context.Context, obj *db.StudentMode
 }
 
 func (r *studentResolver) StudentSkills(ctx context.Context, obj *db.StudentModel) ([]db.StudentSkillModel, error) {
+	if err := r.authorizeStudent(ctx, obj.OwnerID); err != nil {
+		return nil, err
+	}
+	// Students do not see the skills of archived contracts
+	markParams := []db.StudentSkillWhereParam{db.StudentSkill.StudentID.Equals(obj.OwnerID)}
+	contractParams := []db.ContractWhereParam{db.Contract.Groups.Some(db.Group.Students.Some(db.Student.OwnerID.Equals(obj.OwnerID)))}
+	if _, restricted := restrictedStudent(ctx); restricted {
+		markParams = append(markParams, db.StudentSkill.Skill.Where(db.Skill.Contract.Where(db.Contract.Archived.Equals(false))))
+		contractParams = append(contractParams, db.Contract.Archived.Equals(false))
+	}
 	// Find existing studentSkills
-	studentSkills, err := r.Prisma.StudentSkill.FindMany(db.StudentSkill.StudentID.Equals(obj.OwnerID)).Exec(ctx)
+	studentSkills, err := r.Prisma.StudentSkill.FindMany(markParams...).Exec(ctx)
 	if err != nil {
 		return nil, err
 	}
 	// Find to do studentSkills
-	todoSkills, err := r.Prisma.Skill.FindMany(db.Skill.StudentSkills.Every(db.StudentSkill.Not(db.StudentSkill.StudentID.Equals(obj.OwnerID))), db.Skill.Contract.Where(db.Contract.Groups.Some(db.Group.Students.Some(db.Student.OwnerID.Equals(obj.OwnerID))))).Exec(ctx)
+	todoSkills, err := r.Prisma.Skill.FindMany(db.Skill.StudentSkills.Every(db.StudentSkill.Not(db.StudentSkill.StudentID.Equals(obj.OwnerID))), db.Skill.Contract.Where(contractParams...)).Exec(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -441,9 +1469,92 @@ func (r *studentSkillResolver) Skill(ctx context.Context, obj *db.StudentSkillMo
 }
 
 func (r *studentSkillResolver) Student(ctx context.Context, obj *db.StudentSkillModel) (*db.StudentModel, error) {
+	if err := r.authorizeStudent(ctx, obj.StudentID); err != nil {
+		return nil, err
+	}
+	return dataloader.For(ctx).StudentByUsername.Load(obj.StudentID)
+}
+
+func (r *studentSkillResolver) History(ctx context.Context, obj *db.StudentSkillModel) ([]db.StudentSkillEventModel, error) {
+	return r.Prisma.StudentSkillEvent.FindMany(db.StudentSkillEvent.StudentID.Equals(obj.StudentID), db.StudentSkillEvent.SkillID.Equals(obj.SkillID)).OrderBy(db.StudentSkillEvent.CreatedAt.Order(db.SortOrderDesc)).Exec(ctx)
+}
+
+func (r *studentSkillResolver) Comments(ctx context.Context, obj *db.StudentSkillModel) ([]db.StudentSkillCommentModel, error) {
+	return r.Prisma.StudentSkillComment.FindMany(db.StudentSkillComment.StudentID.Equals(obj.StudentID), db.StudentSkillComment.SkillID.Equals(obj.SkillID), db.StudentSkillComment.ParentID.IsNull()).OrderBy(db.StudentSkillComment.CreatedAt.Order(db.SortOrderAsc)).Exec(ctx)
+}
+
+func (r *studentSkillResolver) SelfAssessment(ctx context.Context, obj *db.StudentSkillModel) (*db.SelfAssessmentModel, error) {
+	selfAssessment, err := r.Prisma.SelfAssessment.FindUnique(db.SelfAssessment.StudentIDSkillID(db.SelfAssessment.StudentID.Equals(obj.StudentID), db.SelfAssessment.SkillID.Equals(obj.SkillID))).Exec(ctx)
+	if errors.Is(err, db.ErrNotFound) {
+		return nil, nil
+	}
+	return selfAssessment, err
+}
+
+func (r *studentSkillResolver) Attachments(ctx context.Context, obj *db.StudentSkillModel) ([]db.AttachmentModel, error) {
+	return r.Prisma.Attachment.FindMany(db.Attachment.StudentID.Equals(obj.StudentID), db.Attachment.SkillID.Equals(obj.SkillID)).OrderBy(db.Attachment.CreatedAt.Order(db.SortOrderAsc)).Exec(ctx)
+}
+
+func (r *studentSkillCommentResolver) ParentID(ctx context.Context, obj *db.StudentSkillCommentModel) (*int, error) {
+	parentID, ok := obj.ParentID()
+	if !ok {
+		return nil, nil
+	}
+	return &parentID, nil
+}
+
+func (r *studentSkillCommentResolver) AuthorUsername(ctx context.Context, obj *db.StudentSkillCommentModel) (string, error) {
+	return obj.AuthorID, nil
+}
+
+func (r *studentSkillCommentResolver) Replies(ctx context.Context, obj *db.StudentSkillCommentModel) ([]db.StudentSkillCommentModel, error) {
+	return r.Prisma.StudentSkillComment.FindMany(db.StudentSkillComment.ParentID.Equals(obj.ID)).OrderBy(db.StudentSkillComment.CreatedAt.Order(db.SortOrderAsc)).Exec(ctx)
+}
+
+func (r *studentSkillEventResolver) PreviousMark(ctx context.Context, obj *db.StudentSkillEventModel) (*model.Mark, error) {
+	previousMark, ok := obj.PreviousMark()
+	if !ok {
+		return nil, nil
+	}
+	mark := model.Mark(previousMark)
+	return &mark, nil
+}
+
+func (r *studentSkillEventResolver) NewMark(ctx context.Context, obj *db.StudentSkillEventModel) (model.Mark, error) {
+	return model.Mark(obj.NewMark), nil
+}
+
+func (r *studentSkillEventResolver) AuthorUsername(ctx context.Context, obj *db.StudentSkillEventModel) (string, error) {
+	return obj.AuthorID, nil
+}
+
+func (r *studentSkillEventResolver) Comment(ctx context.Context, obj *db.StudentSkillEventModel) (*string, error) {
+	comment, ok := obj.Comment()
+	if !ok {
+		return nil, nil
+	}
+	return &comment, nil
+}
+
+func (r *studentSkillEventResolver) Skill(ctx context.Context, obj *db.StudentSkillEventModel) (*db.SkillModel, error) {
+	return dataloader.For(ctx).SkillBySkillID.Load(obj.SkillID)
+}
+
+func (r *studentSkillEventResolver) Student(ctx context.Context, obj *db.StudentSkillEventModel) (*db.StudentModel, error) {
+	if err := r.authorizeStudent(ctx, obj.StudentID); err != nil {
+		return nil, err
+	}
 	return dataloader.For(ctx).StudentByUsername.Load(obj.StudentID)
 }
 
+func (r *subscriptionResolver) StudentSkillChanged(ctx context.Context, contractID int, studentUsername *string) (<-chan *db.StudentSkillModel, error) {
+	return r.studentSkillChanges(ctx, contractID, studentUsername)
+}
+
+func (r *subscriptionResolver) ContractChanged(ctx context.Context, id int) (<-chan *db.ContractModel, error) {
+	return r.contractChanges(ctx, id)
+}
+
 func (r *teacherResolver) Owner(ctx context.Context, obj *db.TeacherModel) (*model.User, error) {
 	user, err := r.Prisma.User.FindUnique(db.User.Username.Equals(obj.OwnerID)).Exec(ctx)
 	if err != nil {
@@ -459,6 +1570,14 @@ func (r *teacherResolver) OwnerUsername(ctx context.Context, obj *db.TeacherMode
 	return obj.OwnerID, nil
 }
 
+func (r *templateSkillResolver) Description(ctx context.Context, obj *db.TemplateSkillModel) (*string, error) {
+	return optionalString(obj.Description()), nil
+}
+
+func (r *templateSkillResolver) Category(ctx context.Context, obj *db.TemplateSkillModel) (*string, error) {
+	return optionalString(obj.Category()), nil
+}
+
 func (r *userResolver) Student(ctx context.Context, obj *model.User) ([]db.StudentModel, error) {
 	return r.Prisma.Student.FindMany(db.Student.OwnerID.Equals(obj.Username)).Exec(ctx)
 }
@@ -467,39 +1586,103 @@ func (r *userResolver) Teacher(ctx context.Context, obj *model.User) ([]db.Teach
 	return r.Prisma.Teacher.FindMany(db.Teacher.OwnerID.Equals(obj.Username)).Exec(ctx)
 }
 
+// Attachment returns generated.AttachmentResolver implementation.
+func (r *Resolver) Attachment() generated.AttachmentResolver { return &attachmentResolver{r} }
+
+// Competency returns generated.CompetencyResolver implementation.
+func (r *Resolver) Competency() generated.CompetencyResolver { return &competencyResolver{r} }
+
+// CompetencyDomain returns generated.CompetencyDomainResolver implementation.
+func (r *Resolver) CompetencyDomain() generated.CompetencyDomainResolver {
+	return &competencyDomainResolver{r}
+}
+
 // Contract returns generated.ContractResolver implementation.
 func (r *Resolver) Contract() generated.ContractResolver { return &contractResolver{r} }
 
+// ContractTemplate returns generated.ContractTemplateResolver implementation.
+func (r *Resolver) ContractTemplate() generated.ContractTemplateResolver {
+	return &contractTemplateResolver{r}
+}
+
 // Group returns generated.GroupResolver implementation.
 func (r *Resolver) Group() generated.GroupResolver { return &groupResolver{r} }
 
+// MarkScale returns generated.MarkScaleResolver implementation.
+func (r *Resolver) MarkScale() generated.MarkScaleResolver { return &markScaleResolver{r} }
+
+// MarkScaleLevel returns generated.MarkScaleLevelResolver implementation.
+func (r *Resolver) MarkScaleLevel() generated.MarkScaleLevelResolver {
+	return &markScaleLevelResolver{r}
+}
+
 // Mutation returns generated.MutationResolver implementation.
 func (r *Resolver) Mutation() generated.MutationResolver { return &mutationResolver{r} }
 
 // Query returns generated.QueryResolver implementation.
 func (r *Resolver) Query() generated.QueryResolver { return &queryResolver{r} }
 
+// SelfAssessment returns generated.SelfAssessmentResolver implementation.
+func (r *Resolver) SelfAssessment() generated.SelfAssessmentResolver {
+	return &selfAssessmentResolver{r}
+}
+
+// Session returns generated.SessionResolver implementation.
+func (r *Resolver) Session() generated.SessionResolver { return &sessionResolver{r} }
+
 // Skill returns generated.SkillResolver implementation.
 func (r *Resolver) Skill() generated.SkillResolver { return &skillResolver{r} }
 
+// SkillCategory returns generated.SkillCategoryResolver implementation.
+func (r *Resolver) SkillCategory() generated.SkillCategoryResolver { return &skillCategoryResolver{r} }
+
 // Student returns generated.StudentResolver implementation.
 func (r *Resolver) Student() generated.StudentResolver { return &studentResolver{r} }
 
 // StudentSkill returns generated.StudentSkillResolver implementation.
 func (r *Resolver) StudentSkill() generated.StudentSkillResolver { return &studentSkillResolver{r} }
 
+// StudentSkillComment returns generated.StudentSkillCommentResolver implementation.
+func (r *Resolver) StudentSkillComment() generated.StudentSkillCommentResolver {
+	return &studentSkillCommentResolver{r}
+}
+
+// StudentSkillEvent returns generated.StudentSkillEventResolver implementation.
+func (r *Resolver) StudentSkillEvent() generated.StudentSkillEventResolver {
+	return &studentSkillEventResolver{r}
+}
+
+// Subscription returns generated.SubscriptionResolver implementation.
+func (r *Resolver) Subscription() generated.SubscriptionResolver { return &subscriptionResolver{r} }
+
 // Teacher returns generated.TeacherResolver implementation.
 func (r *Resolver) Teacher() generated.TeacherResolver { return &teacherResolver{r} }
 
+// TemplateSkill returns generated.TemplateSkillResolver implementation.
+func (r *Resolver) TemplateSkill() generated.TemplateSkillResolver { return &templateSkillResolver{r} }
+
 // User returns generated.UserResolver implementation.
 func (r *Resolver) User() generated.UserResolver { return &userResolver{r} }
 
+type attachmentResolver struct{ *Resolver }
+type competencyResolver struct{ *Resolver }
+type competencyDomainResolver struct{ *Resolver }
 type contractResolver struct{ *Resolver }
+type contractTemplateResolver struct{ *Resolver }
 type groupResolver struct{ *Resolver }
+type markScaleResolver struct{ *Resolver }
+type markScaleLevelResolver struct{ *Resolver }
 type mutationResolver struct{ *Resolver }
 type queryResolver struct{ *Resolver }
+type selfAssessmentResolver struct{ *Resolver }
+type sessionResolver struct{ *Resolver }
 type skillResolver struct{ *Resolver }
+type skillCategoryResolver struct{ *Resolver }
 type studentResolver struct{ *Resolver }
 type studentSkillResolver struct{ *Resolver }
+type studentSkillCommentResolver struct{ *Resolver }
+type studentSkillEventResolver struct{ *Resolver }
+type subscriptionResolver struct{ *Resolver }
 type teacherResolver struct{ *Resolver }
+type templateSkillResolver struct{ *Resolver }
 type userResolver struct{ *Resolver }
@@ -0,0 +1,85 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"kontrakt-server/graph/auth"
+	"kontrakt-server/graph/model"
+	"kontrakt-server/prisma/db"
+	"kontrakt-server/utils"
+	"time"
+)
+
+// createSession opens a new session for the user and returns a fresh pair of tokens
+func (r *Resolver) createSession(ctx context.Context, user *db.UserModel) (*model.AuthPayload, error) {
+	refreshID, err := utils.RandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	session, err := r.Prisma.Session.CreateOne(
+		db.Session.Owner.Link(db.User.Username.Equals(user.Username)),
+		db.Session.RefreshID.Set(refreshID),
+		db.Session.ExpiresAt.Set(time.Now().Add(utils.RefreshTokenDuration)),
+	).Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return authPayload(user, session)
+}
+
+// rotateSession checks a refresh token against its session and replaces it with a new one.
+// Presenting an already used refresh token revokes the whole session.
+func (r *Resolver) rotateSession(ctx context.Context, refreshToken string) (*model.AuthPayload, error) {
+	claims, err := utils.VerifyToken(refreshToken, utils.RefreshTokenType)
+	if err != nil {
+		return nil, fmt.Errorf("invalid refresh token")
+	}
+	session, err := r.Prisma.Session.FindUnique(db.Session.ID.Equals(claims.SessionID)).Exec(ctx)
+	if err != nil || !auth.IsSessionActive(session) || session.OwnerID != claims.Username {
+		return nil, fmt.Errorf("session expired")
+	}
+	if session.RefreshID != claims.Id {
+		_, err := r.Prisma.Session.FindUnique(db.Session.ID.Equals(session.ID)).Update(db.Session.Revoked.Set(true)).Exec(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("session expired")
+	}
+
+	refreshID, err := utils.RandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	session, err = r.Prisma.Session.FindUnique(db.Session.ID.Equals(session.ID)).Update(
+		db.Session.RefreshID.Set(refreshID),
+		db.Session.ExpiresAt.Set(time.Now().Add(utils.RefreshTokenDuration)),
+	).Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	user, err := r.Prisma.User.FindUnique(db.User.Username.Equals(session.OwnerID)).Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return authPayload(user, session)
+}
+
+func authPayload(user *db.UserModel, session *db.SessionModel) (*model.AuthPayload, error) {
+	token, err := utils.GetToken(user.Username, session.ID)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, err := utils.GetRefreshToken(user.Username, session.ID, session.RefreshID, session.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return &model.AuthPayload{
+		Token:              token,
+		RefreshToken:       refreshToken,
+		MustChangePassword: user.MustChangePassword,
+		User: &model.User{
+			Username: user.Username,
+			Role:     model.Role(user.Role),
+		},
+	}, nil
+}
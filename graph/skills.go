@@ -0,0 +1,109 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"kontrakt-server/prisma/db"
+	"strings"
+)
+
+// newSkill is a skill created along with its contract, the category is given by name
+type newSkill struct {
+	name         string
+	description  *string
+	category     *string
+	competencyID *int
+}
+
+// copiedSkills returns the skills to create for a copy of a contract, their category must have been fetched
+func copiedSkills(skills []db.SkillModel) []newSkill {
+	copies := make([]newSkill, 0, len(skills))
+	for _, skill := range skills {
+		copied := newSkill{name: skill.Name, description: optionalString(skill.Description())}
+		if category, ok := skill.Category(); ok {
+			copied.category = &category.Name
+		}
+		if competencyID, ok := skill.CompetencyID(); ok {
+			copied.competencyID = &competencyID
+		}
+		copies = append(copies, copied)
+	}
+	return copies
+}
+
+// optionalString turns the value of an optional Prisma field into a pointer
+func optionalString(value string, ok bool) *string {
+	if !ok {
+		return nil
+	}
+	return &value
+}
+
+// skillColumnGroup is a run of spreadsheet columns shown under the same category header
+type skillColumnGroup struct {
+	category string
+	skills   []db.SkillModel
+}
+
+// skillColumnGroups groups skills by category in the order of the categories, uncategorized skills come last.
+// Skills keep their order within a group.
+func skillColumnGroups(skills []db.SkillModel, categories []db.SkillCategoryModel) []skillColumnGroup {
+	byCategory := make(map[int][]db.SkillModel)
+	var uncategorized []db.SkillModel
+	for _, skill := range skills {
+		if categoryID, ok := skill.CategoryID(); ok {
+			byCategory[categoryID] = append(byCategory[categoryID], skill)
+		} else {
+			uncategorized = append(uncategorized, skill)
+		}
+	}
+	var groups []skillColumnGroup
+	for _, category := range categories {
+		if len(byCategory[category.ID]) > 0 {
+			groups = append(groups, skillColumnGroup{category: category.Name, skills: byCategory[category.ID]})
+		}
+	}
+	if len(uncategorized) > 0 {
+		groups = append(groups, skillColumnGroup{skills: uncategorized})
+	}
+	return groups
+}
+
+// validateCategoryName makes sure a category has a name and returns it trimmed
+func validateCategoryName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if len(name) == 0 {
+		return "", fmt.Errorf("a category needs a name")
+	}
+	return name, nil
+}
+
+// validateOrder makes sure the given ids list every existing id exactly once
+func validateOrder(existing []int, ordered []int) error {
+	remaining := make(map[int]bool)
+	for _, id := range existing {
+		remaining[id] = true
+	}
+	for _, id := range ordered {
+		if !remaining[id] {
+			return fmt.Errorf("%d is unknown or listed more than once", id)
+		}
+		delete(remaining, id)
+	}
+	if len(remaining) > 0 {
+		return fmt.Errorf("every item must be listed, %d are missing", len(remaining))
+	}
+	return nil
+}
+
+// checkCategoryOfContract makes sure a category exists and belongs to the contract
+func (r *Resolver) checkCategoryOfContract(ctx context.Context, categoryID int, contractID int) error {
+	category, err := r.Prisma.SkillCategory.FindUnique(db.SkillCategory.ID.Equals(categoryID)).Exec(ctx)
+	if err != nil {
+		return err
+	}
+	if category.ContractID != contractID {
+		return fmt.Errorf("the category %s belongs to another contract", category.Name)
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package graph
+
+import (
+	"context"
+	"kontrakt-server/prisma/db"
+
+	"github.com/prisma/prisma-client-go/runtime/transaction"
+)
+
+// studentDeletion returns the transactions deleting a student and their account along with their marks, history,
+// comments, self-assessments, attachments and sessions.
+// The storage keys of the attachments are returned to be removed once committed.
+func (r *Resolver) studentDeletion(ctx context.Context, username string) ([]transaction.Param, []string, error) {
+	attachments := db.Attachment.Or(db.Attachment.StudentID.Equals(username), db.Attachment.UploaderID.Equals(username))
+	stored, err := r.Prisma.Attachment.FindMany(attachments).Exec(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	var storageKeys []string
+	for _, attachment := range stored {
+		storageKeys = append(storageKeys, attachment.StorageKey)
+	}
+	return []transaction.Param{
+		r.Prisma.Attachment.FindMany(attachments).Delete().Tx(),
+		r.Prisma.SelfAssessment.FindMany(db.SelfAssessment.StudentID.Equals(username)).Delete().Tx(),
+		// Replies belong to the thread of the student they are about, so whole threads are deleted at once
+		r.Prisma.StudentSkillComment.FindMany(db.StudentSkillComment.Or(db.StudentSkillComment.StudentID.Equals(username), db.StudentSkillComment.AuthorID.Equals(username))).Delete().Tx(),
+		r.Prisma.StudentSkillEvent.FindMany(db.StudentSkillEvent.Or(db.StudentSkillEvent.StudentID.Equals(username), db.StudentSkillEvent.AuthorID.Equals(username))).Delete().Tx(),
+		r.Prisma.StudentSkill.FindMany(db.StudentSkill.StudentID.Equals(username)).Delete().Tx(),
+		r.Prisma.Session.FindMany(db.Session.OwnerID.Equals(username)).Delete().Tx(),
+		r.Prisma.Student.FindUnique(db.Student.OwnerID.Equals(username)).Delete().Tx(),
+		r.Prisma.User.FindUnique(db.User.Username.Equals(username)).Delete().Tx(),
+	}, storageKeys, nil
+}
@@ -0,0 +1,158 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"kontrakt-server/graph/auth"
+	"kontrakt-server/prisma/db"
+	"log"
+)
+
+// studentSkillChange is published when the mark of a student changes, subscribers fetch the new mark themselves
+// so the messages stay small for brokers shared between instances
+type studentSkillChange struct {
+	StudentUsername string `json:"studentUsername"`
+	SkillID         int    `json:"skillID"`
+}
+
+func studentSkillTopic(contractID int) string {
+	return fmt.Sprintf("contracts/%d/student-skills", contractID)
+}
+
+func contractTopic(contractID int) string {
+	return fmt.Sprintf("contracts/%d", contractID)
+}
+
+// publish sends a message to the subscribers of a topic.
+// The change is already saved at this point so failures are only logged.
+func (r *Resolver) publish(ctx context.Context, topic string, message interface{}) {
+	payload, err := json.Marshal(message)
+	if err == nil {
+		err = r.Broker.Publish(ctx, topic, payload)
+	}
+	if err != nil {
+		log.Printf("could not publish to %s: %v", topic, err)
+	}
+}
+
+// publishContractChanged tells the subscribers of contracts that they changed
+func (r *Resolver) publishContractChanged(ctx context.Context, contractIDs ...int) {
+	for _, contractID := range contractIDs {
+		r.publish(ctx, contractTopic(contractID), contractID)
+	}
+}
+
+// publishStudentSkillChanges tells the subscribers of the contracts of the skills that marks changed
+func (r *Resolver) publishStudentSkillChanges(ctx context.Context, changes []studentSkillChange) {
+	var skillIDs []int
+	for _, change := range changes {
+		skillIDs = append(skillIDs, change.SkillID)
+	}
+	if len(skillIDs) == 0 {
+		return
+	}
+	skills, err := r.Prisma.Skill.FindMany(db.Skill.ID.In(skillIDs)).Exec(ctx)
+	if err != nil {
+		log.Printf("could not publish mark changes: %v", err)
+		return
+	}
+	contractIDs := make(map[int]int)
+	for _, skill := range skills {
+		contractIDs[skill.ID] = skill.ContractID
+	}
+	for _, change := range changes {
+		r.publish(ctx, studentSkillTopic(contractIDs[change.SkillID]), change)
+	}
+}
+
+// canStillFollow reports whether a subscriber can receive a new change of a contract.
+// Websockets authenticate once, so the session may have been revoked or the contract archived since the subscription started.
+func (r *Resolver) canStillFollow(ctx context.Context, contractID int) bool {
+	if session := auth.SessionForContext(ctx); session != nil {
+		current, err := r.Prisma.Session.FindUnique(db.Session.ID.Equals(session.ID)).Exec(ctx)
+		if err != nil || !auth.IsSessionActive(current) {
+			return false
+		}
+	}
+	return r.authorizeContract(ctx, contractID) == nil
+}
+
+// studentSkillChanges streams the marks of a contract as they change, optionally only those of a student,
+// until the contract cannot be followed anymore
+func (r *Resolver) studentSkillChanges(ctx context.Context, contractID int, studentUsername *string) (<-chan *db.StudentSkillModel, error) {
+	if err := r.authorizeContract(ctx, contractID); err != nil {
+		return nil, err
+	}
+	// Students only follow their own marks
+	if me, restricted := restrictedStudent(ctx); restricted {
+		if studentUsername != nil && *studentUsername != me {
+			return nil, auth.Forbidden()
+		}
+		studentUsername = &me
+	}
+	messages, err := r.Broker.Subscribe(ctx, studentSkillTopic(contractID))
+	if err != nil {
+		return nil, err
+	}
+	changes := make(chan *db.StudentSkillModel, 1)
+	go func() {
+		defer close(changes)
+		for payload := range messages {
+			var change studentSkillChange
+			if err := json.Unmarshal(payload, &change); err != nil {
+				continue
+			}
+			if studentUsername != nil && change.StudentUsername != *studentUsername {
+				continue
+			}
+			if !r.canStillFollow(ctx, contractID) {
+				return
+			}
+			studentSkill, err := r.Prisma.StudentSkill.FindUnique(db.StudentSkill.StudentIDSkillID(db.StudentSkill.StudentID.Equals(change.StudentUsername), db.StudentSkill.SkillID.Equals(change.SkillID))).Exec(ctx)
+			if err != nil {
+				continue
+			}
+			select {
+			case changes <- studentSkill:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return changes, nil
+}
+
+// contractChanges streams a contract as it changes, until it is deleted or cannot be followed anymore
+func (r *Resolver) contractChanges(ctx context.Context, contractID int) (<-chan *db.ContractModel, error) {
+	if err := r.authorizeContract(ctx, contractID); err != nil {
+		return nil, err
+	}
+	messages, err := r.Broker.Subscribe(ctx, contractTopic(contractID))
+	if err != nil {
+		return nil, err
+	}
+	changes := make(chan *db.ContractModel, 1)
+	go func() {
+		defer close(changes)
+		for range messages {
+			if !r.canStillFollow(ctx, contractID) {
+				return
+			}
+			contract, err := r.Prisma.Contract.FindUnique(db.Contract.ID.Equals(contractID)).Exec(ctx)
+			if errors.Is(err, db.ErrNotFound) {
+				return
+			}
+			if err != nil {
+				continue
+			}
+			select {
+			case changes <- contract:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return changes, nil
+}
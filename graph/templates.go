@@ -0,0 +1,78 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"kontrakt-server/graph/model"
+	"kontrakt-server/prisma/db"
+	"strings"
+
+	"github.com/prisma/prisma-client-go/runtime/transaction"
+)
+
+// validateTemplateName makes sure a template has a name no other template uses and returns it trimmed
+func (r *Resolver) validateTemplateName(ctx context.Context, templateID int, name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if len(name) == 0 {
+		return "", fmt.Errorf("a template needs a name")
+	}
+	others, err := r.Prisma.ContractTemplate.FindMany(db.ContractTemplate.Name.Equals(name), db.ContractTemplate.Not(db.ContractTemplate.ID.Equals(templateID))).Exec(ctx)
+	if err != nil {
+		return "", err
+	}
+	if len(others) > 0 {
+		return "", templateNameTaken(name)
+	}
+	return name, nil
+}
+
+func templateNameTaken(name string) error {
+	return fmt.Errorf("a template named %s already exists", name)
+}
+
+// validateTemplateSkills makes sure every skill of a template has a name and returns them trimmed
+func validateTemplateSkills(skills []model.TemplateSkillInput) ([]model.TemplateSkillInput, error) {
+	if len(skills) == 0 {
+		return nil, fmt.Errorf("a template needs at least one skill")
+	}
+	trimmed := make([]model.TemplateSkillInput, 0, len(skills))
+	for position, skill := range skills {
+		name := strings.TrimSpace(skill.Name)
+		if len(name) == 0 {
+			return nil, fmt.Errorf("skill %d needs a name", position+1)
+		}
+		if skill.Category != nil {
+			category, err := validateCategoryName(*skill.Category)
+			if err != nil {
+				return nil, err
+			}
+			skill.Category = &category
+		}
+		trimmed = append(trimmed, model.TemplateSkillInput{Name: name, Description: skill.Description, Category: skill.Category})
+	}
+	return trimmed, nil
+}
+
+// createTemplateSkills returns the transactions creating the skills of a template, ordered as given
+func (r *Resolver) createTemplateSkills(template db.ContractTemplateWhereParam, skills []model.TemplateSkillInput) []transaction.Param {
+	var transactions []transaction.Param
+	for position, skill := range skills {
+		transactions = append(transactions, r.Prisma.TemplateSkill.CreateOne(
+			db.TemplateSkill.Template.Link(template),
+			db.TemplateSkill.Name.Set(skill.Name),
+			db.TemplateSkill.Position.Set(position),
+			db.TemplateSkill.Description.SetIfPresent(skill.Description),
+			db.TemplateSkill.Category.SetIfPresent(skill.Category),
+		).Tx())
+	}
+	return transactions
+}
+
+// templateNewSkills returns the skills to create for a contract made from a template
+func templateNewSkills(skills []db.TemplateSkillModel) []newSkill {
+	created := make([]newSkill, 0, len(skills))
+	for _, skill := range skills {
+		created = append(created, newSkill{name: skill.Name, description: optionalString(skill.Description()), category: optionalString(skill.Category())})
+	}
+	return created
+}
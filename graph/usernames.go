@@ -0,0 +1,56 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"kontrakt-server/prisma/db"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var usernameRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+
+// validateUsername makes sure a username chosen by a teacher is usable and returns it in lower case
+func validateUsername(username string) (string, error) {
+	username = strings.ToLower(strings.TrimSpace(username))
+	if !usernameRegexp.MatchString(username) {
+		return "", fmt.Errorf("the username %s can only contain letters, digits, dots, dashes and underscores", username)
+	}
+	return username, nil
+}
+
+func usernameTaken(username string) error {
+	return fmt.Errorf("the username %s is already taken", username)
+}
+
+// takenUsernames returns the usernames starting with one of the given ones
+func (r *Resolver) takenUsernames(ctx context.Context, prefixes []string) (map[string]bool, error) {
+	taken := make(map[string]bool)
+	if len(prefixes) == 0 {
+		return taken, nil
+	}
+	var params []db.UserWhereParam
+	for _, prefix := range prefixes {
+		params = append(params, db.User.Username.StartsWith(prefix))
+	}
+	users, err := r.Prisma.User.FindMany(db.User.Or(params...)).Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, user := range users {
+		taken[user.Username] = true
+	}
+	return taken, nil
+}
+
+// nextUsername returns the base if it is free, otherwise the base followed by the first free number from 2.
+// The returned username is marked as taken.
+func nextUsername(base string, taken map[string]bool) string {
+	username := base
+	for suffix := 2; taken[username]; suffix++ {
+		username = base + strconv.Itoa(suffix)
+	}
+	taken[username] = true
+	return username
+}
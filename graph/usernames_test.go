@@ -0,0 +1,42 @@
+package graph
+
+import "testing"
+
+func TestNextUsername(t *testing.T) {
+	tests := []struct {
+		name  string
+		base  string
+		taken []string
+		want  string
+	}{
+		{"free base", "mdupont", nil, "mdupont"},
+		{"taken base", "mdupont", []string{"mdupont"}, "mdupont2"},
+		{"first free number", "mdupont", []string{"mdupont", "mdupont2", "mdupont3"}, "mdupont4"},
+		{"gaps are filled", "mdupont", []string{"mdupont", "mdupont3"}, "mdupont2"},
+		{"other usernames do not matter", "mdupont", []string{"mdupont2", "mdupontel"}, "mdupont"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			taken := make(map[string]bool)
+			for _, username := range test.taken {
+				taken[username] = true
+			}
+			got := nextUsername(test.base, taken)
+			if got != test.want {
+				t.Errorf("nextUsername(%q) = %q, want %q", test.base, got, test.want)
+			}
+			if !taken[got] {
+				t.Errorf("nextUsername(%q) did not mark %q as taken", test.base, got)
+			}
+		})
+	}
+}
+
+func TestNextUsernameSequence(t *testing.T) {
+	taken := map[string]bool{"mdupont": true}
+	for _, want := range []string{"mdupont2", "mdupont3", "mdupont4"} {
+		if got := nextUsername("mdupont", taken); got != want {
+			t.Errorf("nextUsername() = %q, want %q", got, want)
+		}
+	}
+}
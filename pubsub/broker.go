@@ -0,0 +1,13 @@
+package pubsub
+
+import (
+	"context"
+)
+
+// Broker delivers the messages published on a topic to its subscribers.
+// Deployments running several instances need a broker shared by all of them.
+type Broker interface {
+	Publish(ctx context.Context, topic string, payload []byte) error
+	// Subscribe returns the messages published on a topic until the context is done, the channel is then closed
+	Subscribe(ctx context.Context, topic string) (<-chan []byte, error)
+}
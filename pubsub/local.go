@@ -0,0 +1,54 @@
+package pubsub
+
+import (
+	"context"
+	"sync"
+)
+
+// subscriberBuffer is how many messages a slow subscriber can fall behind before missing some
+const subscriberBuffer = 16
+
+// Local delivers messages to the subscribers of the same process
+type Local struct {
+	mu          sync.Mutex
+	subscribers map[string]map[chan []byte]bool
+}
+
+func NewLocal() *Local {
+	return &Local{subscribers: make(map[string]map[chan []byte]bool)}
+}
+
+func (l *Local) Publish(ctx context.Context, topic string, payload []byte) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for subscriber := range l.subscribers[topic] {
+		// Publishers never wait for slow subscribers
+		select {
+		case subscriber <- payload:
+		default:
+		}
+	}
+	return nil
+}
+
+func (l *Local) Subscribe(ctx context.Context, topic string) (<-chan []byte, error) {
+	subscriber := make(chan []byte, subscriberBuffer)
+	l.mu.Lock()
+	if l.subscribers[topic] == nil {
+		l.subscribers[topic] = make(map[chan []byte]bool)
+	}
+	l.subscribers[topic][subscriber] = true
+	l.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		delete(l.subscribers[topic], subscriber)
+		if len(l.subscribers[topic]) == 0 {
+			delete(l.subscribers, topic)
+		}
+		close(subscriber)
+	}()
+	return subscriber, nil
+}
@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"github.com/99designs/gqlgen/graphql"
 	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/99designs/gqlgen/graphql/handler/lru"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
 	"github.com/99designs/gqlgen/graphql/playground"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/rs/cors"
@@ -15,19 +18,30 @@ import (
 	"kontrakt-server/graph/generated"
 	"kontrakt-server/graph/model"
 	"kontrakt-server/prisma/db"
+	"kontrakt-server/pubsub"
+	"kontrakt-server/storage"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/awslabs/aws-lambda-go-api-proxy/gorillamux"
 	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
 )
 
 var muxRouter *mux.Router
 var prismaClient *db.PrismaClient
 
+// passwordChangeFields are the only fields users with a temporary password can use
+var passwordChangeFields = map[string]bool{
+	"changeMyPassword": true,
+	"logout":           true,
+}
+
 func init() {
 	muxRouter = mux.NewRouter()
 
@@ -39,15 +53,45 @@ func init() {
 		prismaClient = client
 	}
 
-	config := generated.Config{Resolvers: &graph.Resolver{
-		Prisma: prismaClient,
-	}}
+	fileStorage, err := newStorage()
+	if err != nil {
+		panic(err)
+	}
+
+	resolver := &graph.Resolver{
+		Prisma:            prismaClient,
+		Storage:           fileStorage,
+		Broker:            pubsub.NewLocal(),
+		MaxAttachmentSize: maxAttachmentSize(),
+	}
+	config := generated.Config{Resolvers: resolver}
 
 	config.Directives.HasRole = func(ctx context.Context, obj interface{}, next graphql.Resolver, role model.Role) (interface{}, error) {
 		forContext := auth.ForContext(ctx)
-		if forContext == nil || string(forContext.Role) != role.String() {
+		if !auth.HasRole(forContext, db.Role(role)) {
+			// block calling the next resolver
+			return nil, auth.Forbidden()
+		}
+		if forContext.MustChangePassword {
+			return nil, fmt.Errorf("Password change required")
+		}
+
+		// or let it pass through
+		return next(ctx)
+	}
+
+	config.Directives.HasAnyRole = func(ctx context.Context, obj interface{}, next graphql.Resolver, roles []model.Role) (interface{}, error) {
+		forContext := auth.ForContext(ctx)
+		var dbRoles []db.Role
+		for _, role := range roles {
+			dbRoles = append(dbRoles, db.Role(role))
+		}
+		if !auth.HasAnyRole(forContext, dbRoles) {
 			// block calling the next resolver
-			return nil, fmt.Errorf("Access denied")
+			return nil, auth.Forbidden()
+		}
+		if forContext.MustChangePassword {
+			return nil, fmt.Errorf("Password change required")
 		}
 
 		// or let it pass through
@@ -58,7 +102,11 @@ func init() {
 		forContext := auth.ForContext(ctx)
 		if forContext == nil {
 			// block calling the next resolver
-			return nil, fmt.Errorf("Access denied")
+			return nil, auth.Unauthenticated()
+		}
+		// A temporary password only lets the user choose a new one
+		if forContext.MustChangePassword && !passwordChangeFields[graphql.GetFieldContext(ctx).Field.Name] {
+			return nil, fmt.Errorf("Password change required")
 		}
 
 		// or let it pass through
@@ -80,7 +128,7 @@ func init() {
 		if err != nil {
 			panic(err)
 		}
-		createdUser, err := prismaClient.User.CreateOne(db.User.Username.Set(username), db.User.Password.Set(string(hashedPassword)), db.User.Role.Set(db.RoleTEACHER)).Exec(ctx)
+		createdUser, err := prismaClient.User.CreateOne(db.User.Username.Set(username), db.User.Password.Set(string(hashedPassword)), db.User.Role.Set(db.RoleADMIN)).Exec(ctx)
 		if err != nil {
 			panic(err)
 		}
@@ -91,8 +139,35 @@ func init() {
 	}
 
 	schema := generated.NewExecutableSchema(config)
-	server := handler.NewDefaultServer(schema)
+	server := handler.New(schema)
+	server.AddTransport(transport.Websocket{
+		KeepAlivePingInterval: 10 * time.Second,
+		Upgrader: websocket.Upgrader{
+			CheckOrigin: checkWebsocketOrigin,
+		},
+		// Browsers cannot set headers on websockets, the token comes with the connection payload
+		InitFunc: func(ctx context.Context, initPayload transport.InitPayload) (context.Context, error) {
+			tokenString := initPayload.Authorization()
+			if len(tokenString) == 0 {
+				return ctx, nil
+			}
+			return auth.Authenticate(ctx, prismaClient, tokenString)
+		},
+	})
+	server.AddTransport(transport.Options{})
+	server.AddTransport(transport.GET{})
+	server.AddTransport(transport.POST{})
+	server.AddTransport(transport.MultipartForm{})
+	server.SetQueryCache(lru.New(1000))
+	server.Use(extension.Introspection{})
+	server.Use(extension.AutomaticPersistedQuery{
+		Cache: lru.New(100),
+	})
 	muxRouter.Handle("/query", dataloader.Middleware(prismaClient, server))
+	muxRouter.Handle("/attachments/{id:[0-9]+}", resolver.AttachmentHandler())
+	muxRouter.Handle("/exports/{id:[0-9a-f]+}", resolver.ExportHandler())
+	muxRouter.Handle("/reports/students/{username}", resolver.StudentReportHandler())
+	muxRouter.Handle("/reports/groups/{id:[0-9]+}", resolver.GroupReportHandler())
 	muxRouter.Handle("/", playground.Handler("GraphQL playground", "/query"))
 	muxRouter.Use(auth.Middleware(prismaClient))
 	muxRouter.Use(cors.New(cors.Options{
@@ -104,20 +179,76 @@ func init() {
 
 }
 
+// checkWebsocketOrigin accepts websockets opened from the same host or from one of the comma separated ALLOWED_ORIGINS.
+// Browsers do not apply CORS to websockets, so without this any site could use the session of a visitor.
+func checkWebsocketOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if len(origin) == 0 {
+		// Not opened by a browser
+		return true
+	}
+	parsed, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(parsed.Host, r.Host) {
+		return true
+	}
+	for _, allowed := range strings.Split(os.Getenv("ALLOWED_ORIGINS"), ",") {
+		if strings.EqualFold(strings.TrimSuffix(strings.TrimSpace(allowed), "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
 func lambdaHandler(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 	muxAdapter := gorillamux.New(muxRouter)
 
-	rsp, err := muxAdapter.Proxy(req)
+	rsp, err := muxAdapter.ProxyWithContext(ctx, req)
 	if err != nil {
 		log.Println(err)
 	}
 	return rsp, err
 }
 
-func main() {
-	isRunningAtLambda := strings.Contains(os.Getenv("AWS_EXECUTION_ENV"), "AWS_Lambda_")
+// newStorage returns where attachments are stored: a S3 bucket, a directory, or nowhere when none is configured.
+// Only a configured storage failing to start stops the server.
+func newStorage() (storage.Storage, error) {
+	if bucket := os.Getenv("ATTACHMENTS_BUCKET"); bucket != "" {
+		return storage.NewS3(bucket, os.Getenv("AWS_REGION"))
+	}
+	if dir := os.Getenv("ATTACHMENTS_DIR"); dir != "" {
+		return storage.NewLocal(dir)
+	}
+	// The filesystem of Lambda is read-only and not shared between instances
+	if isRunningAtLambda() {
+		log.Println("attachments are disabled, set ATTACHMENTS_BUCKET to enable them")
+		return storage.Disabled{}, nil
+	}
+	local, err := storage.NewLocal("attachments")
+	if err != nil {
+		log.Printf("attachments are disabled: %v", err)
+		return storage.Disabled{}, nil
+	}
+	return local, nil
+}
+
+// maxAttachmentSize leaves room for the base64 encoding and the multipart envelope of uploads under Lambda,
+// whose requests cannot be larger than 6 MB
+func maxAttachmentSize() int64 {
+	if isRunningAtLambda() {
+		return 4 << 20
+	}
+	return 10 << 20
+}
 
-	if isRunningAtLambda {
+func isRunningAtLambda() bool {
+	return strings.Contains(os.Getenv("AWS_EXECUTION_ENV"), "AWS_Lambda_")
+}
+
+func main() {
+	if isRunningAtLambda() {
 		lambda.Start(lambdaHandler)
 	} else {
 		defaultPort := "7010"
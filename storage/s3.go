@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// S3 stores files in an Amazon S3 bucket, so they are kept when Lambda instances go away and shared between them
+type S3 struct {
+	bucket    string
+	client    *s3.Client
+	presigner *s3.PresignClient
+}
+
+// NewS3 uses the credentials found in the environment, which Lambda sets for the role of the function
+func NewS3(bucket string, region string) (*S3, error) {
+	if region == "" {
+		return nil, fmt.Errorf("the region of the %s bucket is missing, set AWS_REGION", bucket)
+	}
+	cfg, err := config.LoadDefaultConfig(context.Background(), config.WithRegion(region))
+	if err != nil {
+		return nil, err
+	}
+	return newS3(bucket, s3.NewFromConfig(cfg)), nil
+}
+
+func newS3(bucket string, client *s3.Client) *S3 {
+	return &S3{bucket: bucket, client: client, presigner: s3.NewPresignClient(client)}
+}
+
+func checkKey(key string) error {
+	// Keys are flat names, never paths
+	if key == "" || key != path.Base(key) {
+		return fmt.Errorf("invalid storage key %q", key)
+	}
+	return nil
+}
+
+func (s *S3) Save(ctx context.Context, key string, content io.Reader) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	// S3 needs the length of the content before it is sent, files are small enough to be read first
+	body, err := ioutil.ReadAll(content)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.PutObject(ctx, &s3.PutObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(key), Body: bytes.NewReader(body)})
+	return err
+}
+
+func (s *S3) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+	object, err := s.client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(key)})
+	var noSuchKey *types.NoSuchKey
+	if errors.As(err, &noSuchKey) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return object.Body, nil
+}
+
+// Delete succeeds when the file is already gone, S3 does not tell them apart
+func (s *S3) Delete(ctx context.Context, key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(key)})
+	return err
+}
+
+// PresignGet returns a link downloading a file directly from the bucket until it expires
+func (s *S3) PresignGet(key string, contentType string, disposition string, expires time.Duration) (string, error) {
+	if err := checkKey(key); err != nil {
+		return "", err
+	}
+	input := &s3.GetObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(key)}
+	if contentType != "" {
+		input.ResponseContentType = aws.String(contentType)
+	}
+	if disposition != "" {
+		input.ResponseContentDisposition = aws.String(disposition)
+	}
+	request, err := s.presigner.PresignGetObject(context.Background(), input, s3.WithPresignExpires(expires))
+	if err != nil {
+		return "", err
+	}
+	return request.URL, nil
+}
@@ -0,0 +1,24 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+var ErrNotFound = errors.New("file not found")
+
+// Storage keeps uploaded files under opaque keys chosen by the caller
+type Storage interface {
+	Save(ctx context.Context, key string, content io.Reader) error
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// Presigner is implemented by storages that files can be downloaded from directly, without going through the server
+type Presigner interface {
+	// PresignGet returns a link downloading a file until it expires.
+	// The response gets the given Content-Type and Content-Disposition headers unless they are empty.
+	PresignGet(key string, contentType string, disposition string, expires time.Duration) (string, error)
+}
@@ -1,28 +1,82 @@
 package utils
 
 import (
+	"fmt"
 	jwt "github.com/dgrijalva/jwt-go"
 	"os"
+	"time"
 )
 
-func GetToken(username string) (string, error) {
+const (
+	AccessTokenDuration  = 15 * time.Minute
+	RefreshTokenDuration = 30 * 24 * time.Hour
+)
+
+const (
+	AccessTokenType  = "access"
+	RefreshTokenType = "refresh"
+)
+
+type TokenClaims struct {
+	Username  string `json:"username"`
+	SessionID string `json:"sid"`
+	Type      string `json:"typ"`
+	jwt.StandardClaims
+}
+
+// GetToken signs a short-lived access token bound to the given session
+func GetToken(username string, sessionID string) (string, error) {
+	now := time.Now()
+	return signToken(TokenClaims{
+		Username:  username,
+		SessionID: sessionID,
+		Type:      AccessTokenType,
+		StandardClaims: jwt.StandardClaims{
+			Id:        sessionID,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(AccessTokenDuration).Unix(),
+		},
+	})
+}
+
+// GetRefreshToken signs a refresh token identified by refreshID, valid until the session expires
+func GetRefreshToken(username string, sessionID string, refreshID string, expiresAt time.Time) (string, error) {
+	return signToken(TokenClaims{
+		Username:  username,
+		SessionID: sessionID,
+		Type:      RefreshTokenType,
+		StandardClaims: jwt.StandardClaims{
+			Id:        refreshID,
+			IssuedAt:  time.Now().Unix(),
+			ExpiresAt: expiresAt.Unix(),
+		},
+	})
+}
+
+func signToken(claims TokenClaims) (string, error) {
 	value := os.Getenv("JWT_KEY")
 	signingKey := []byte(value)
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"username": username,
-	})
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	tokenString, err := token.SignedString(signingKey)
 	return tokenString, err
 }
 
-func VerifyToken(tokenString string) (jwt.Claims, error) {
+// VerifyToken checks the signature and expiry of a token and that it is of the expected type
+func VerifyToken(tokenString string, tokenType string) (*TokenClaims, error) {
 	value := os.Getenv("JWT_KEY")
 	signingKey := []byte(value)
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+	claims := &TokenClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
 		return signingKey, nil
 	})
 	if err != nil {
 		return nil, err
 	}
-	return token.Claims, err
+	if claims.Type != tokenType || claims.SessionID == "" {
+		return nil, fmt.Errorf("invalid token type")
+	}
+	return claims, nil
 }
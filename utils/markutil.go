@@ -1,48 +1,50 @@
 package utils
 
-import "kontrakt-server/prisma/db"
+import (
+	"fmt"
+	"kontrakt-server/prisma/db"
+)
 
 type MarkData struct {
 	Text  string
+	Color string
 	Style string
 }
 
+func newMarkData(text string, color string) MarkData {
+	return MarkData{
+		Text:  text,
+		Color: color,
+		Style: fmt.Sprintf(`{"fill":{"type":"pattern","color":["%s"],"pattern":1}}`, color),
+	}
+}
+
 func GetMarkData(mark db.Mark) MarkData {
 	switch mark {
 	default:
-		return MarkData{
-			Text:  "À faire",
-			Style: `{"fill":{"type":"pattern","color":["#a3a3a3"],"pattern":1}}`,
-		}
+		return newMarkData("À faire", "#a3a3a3")
 	case db.MarkTOFINISH:
-		return MarkData{
-			Text:  "À Terminer",
-			Style: `{"fill":{"type":"pattern","color":["#a3a3a3"],"pattern":1}}`,
-		}
+		return newMarkData("À Terminer", "#a3a3a3")
 	case db.MarkTOCORRECT:
-		return MarkData{
-			Text:  "À corriger",
-			Style: `{"fill":{"type":"pattern","color":["#a3a3a3"],"pattern":1}}`,
-		}
+		return newMarkData("À corriger", "#a3a3a3")
 	case db.MarkGOOD:
-		return MarkData{
-			Text:  "Acquis avec quelques erreurs",
-			Style: `{"fill":{"type":"pattern","color":["#0040ff"],"pattern":1}}`,
-		}
+		return newMarkData("Acquis avec quelques erreurs", "#0040ff")
 	case db.MarkVERYGOOD:
-		return MarkData{
-			Text:  "Acquis",
-			Style: `{"fill":{"type":"pattern","color":["#15ff00"],"pattern":1}}`,
-		}
+		return newMarkData("Acquis", "#15ff00")
 	case db.MarkBAD:
-		return MarkData{
-			Text:  "En voie d'acquisition",
-			Style: `{"fill":{"type":"pattern","color":["#ff8c00"],"pattern":1}}`,
-		}
+		return newMarkData("En voie d'acquisition", "#ff8c00")
 	case db.MarkVERYBAD:
-		return MarkData{
-			Text:  "Non acquis",
-			Style: `{"fill":{"type":"pattern","color":["#ff0000"],"pattern":1}}`,
+		return newMarkData("Non acquis", "#ff0000")
+	}
+}
+
+// GetScaleMarkData returns the label and color the scale defines for the mark,
+// falling back to the default ones when the mark is not part of the scale
+func GetScaleMarkData(levels []db.MarkScaleLevelModel, mark db.Mark) MarkData {
+	for _, level := range levels {
+		if level.Mark == mark {
+			return newMarkData(level.Label, level.HexColor)
 		}
 	}
+	return GetMarkData(mark)
 }
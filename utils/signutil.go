@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+// SignURL appends an expiry and a signature to a path so it can be fetched without an Authorization header
+func SignURL(path string, expiresAt time.Time) string {
+	expires := strconv.FormatInt(expiresAt.Unix(), 10)
+	query := url.Values{}
+	query.Set("expires", expires)
+	query.Set("signature", signature(path, expires))
+	return path + "?" + query.Encode()
+}
+
+// VerifySignedURL checks the signature and expiry SignURL added to the query of a path
+func VerifySignedURL(path string, query url.Values) error {
+	expires := query.Get("expires")
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid expiry")
+	}
+	if !hmac.Equal([]byte(query.Get("signature")), []byte(signature(path, expires))) {
+		return fmt.Errorf("invalid signature")
+	}
+	if time.Now().Unix() > expiresAt {
+		return fmt.Errorf("link expired")
+	}
+	return nil
+}
+
+func signature(path string, expires string) string {
+	mac := hmac.New(sha256.New, []byte(os.Getenv("JWT_KEY")))
+	mac.Write([]byte(path + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignURL(t *testing.T) {
+	os.Setenv("JWT_KEY", "test")
+	defer os.Unsetenv("JWT_KEY")
+	expiresAt := time.Now().Add(time.Minute)
+	query := func(link string) url.Values {
+		parsed, err := url.Parse(link)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed.Query()
+	}
+	signed := SignURL("/attachments/1", expiresAt)
+	if !strings.HasPrefix(signed, "/attachments/1?") {
+		t.Fatalf("SignURL() = %s, want the path followed by a query", signed)
+	}
+
+	tampered := query(signed)
+	tampered.Set("expires", tampered.Get("expires")+"0")
+	otherKey := query(signed)
+	expired := query(SignURL("/attachments/1", time.Now().Add(-time.Second)))
+	tests := []struct {
+		name    string
+		path    string
+		query   url.Values
+		key     string
+		wantErr string
+	}{
+		{"valid", "/attachments/1", query(signed), "test", ""},
+		{"other path", "/attachments/2", query(signed), "test", "invalid signature"},
+		{"extended expiry", "/attachments/1", tampered, "test", "invalid signature"},
+		{"other key", "/attachments/1", otherKey, "other", "invalid signature"},
+		{"expired", "/attachments/1", expired, "test", "link expired"},
+		{"missing expiry", "/attachments/1", url.Values{}, "test", "invalid expiry"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			os.Setenv("JWT_KEY", test.key)
+			err := VerifySignedURL(test.path, test.query)
+			if test.wantErr == "" && err != nil {
+				t.Errorf("VerifySignedURL() = %v, want no error", err)
+			}
+			if test.wantErr != "" && (err == nil || err.Error() != test.wantErr) {
+				t.Errorf("VerifySignedURL() = %v, want %s", err, test.wantErr)
+			}
+		})
+	}
+}
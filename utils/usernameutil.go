@@ -0,0 +1,32 @@
+package utils
+
+import (
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Letters that do not decompose into a base letter and an accent
+var ligatures = strings.NewReplacer("æ", "ae", "œ", "oe", "ø", "o", "ß", "ss", "ł", "l", "đ", "d")
+
+// asciiLetters returns the lower case letters and digits of a name, accents removed
+func asciiLetters(name string) string {
+	var builder strings.Builder
+	for _, r := range norm.NFD.String(ligatures.Replace(strings.ToLower(name))) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			builder.WriteRune(r)
+		}
+	}
+	return builder.String()
+}
+
+// UsernameBase returns the username a student gets when nobody else uses it: the initial of their first name
+// followed by their last name, in lower case without accents, spaces or punctuation.
+// It is empty when the names have no usable letter.
+func UsernameBase(firstName string, lastName string) string {
+	first, last := asciiLetters(firstName), asciiLetters(lastName)
+	if len(first) == 0 || len(last) == 0 {
+		return first + last
+	}
+	return first[:1] + last
+}
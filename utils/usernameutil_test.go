@@ -0,0 +1,30 @@
+package utils
+
+import "testing"
+
+func TestUsernameBase(t *testing.T) {
+	tests := []struct {
+		name      string
+		firstName string
+		lastName  string
+		want      string
+	}{
+		{"simple names", "Marie", "Dupont", "mdupont"},
+		{"accents are removed", "Élodie", "Lefèvre", "elefevre"},
+		{"spaces and punctuation are removed", "Jean-Pierre", "De La Tour", "jdelatour"},
+		{"apostrophes are removed", "Anne", "O'Connor", "aoconnor"},
+		{"ligatures are spelled out", "Œdipe", "Grœn", "ogroen"},
+		{"letters without decomposition", "Łukasz", "Søren", "lsoren"},
+		{"digits are kept", "Louis", "XIV 2", "lxiv2"},
+		{"first name without letters", "!!", "Dupont", "dupont"},
+		{"last name without letters", "Marie", "", "marie"},
+		{"no usable letter", "漢字", "—", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := UsernameBase(test.firstName, test.lastName); got != test.want {
+				t.Errorf("UsernameBase(%q, %q) = %q, want %q", test.firstName, test.lastName, got, test.want)
+			}
+		})
+	}
+}